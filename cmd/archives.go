@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// verifyArchives decompresses every .gz and .zst file in and below folder to check its integrity
+// and returns the number of corrupt or truncated archives found. When repair is set, corrupt
+// archives are removed so a later gather can collect them again.
+func verifyArchives(folder string, repair bool) int {
+	var checked, corrupt int
+	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logf("[error] cannot read %q: %v", fileName(path), err)
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(d.Name())); d.IsDir() || (ext != gatherer.FormatExt("gzip") && ext != gatherer.FormatExt("zstd")) {
+			return nil
+		}
+		checked++
+		if err := checkCompressed(path); err != nil {
+			corrupt++
+			logf("[error] archive %q is corrupt: %v", fileName(path), err)
+			if repair {
+				if err := os.Remove(path); err != nil {
+					logf("[error] cannot remove corrupt archive %q: %v", fileName(path), err)
+				} else {
+					logf("[info] removed corrupt archive %q", fileName(path))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fatalf("[fatal] cannot verify archives in %q: %v", fileName(folder), err)
+	}
+	logf("[info] verified %d archive(s) in %q, %d corrupt", checked, fileName(folder), corrupt)
+	return corrupt
+}
+
+// checkCompressed reads the gzip or zstd file at path up to the end, which validates its checksum
+// and size.
+func checkCompressed(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gatherer.NewDecompressor(path, f)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return err
+	}
+	return zr.Close()
+}
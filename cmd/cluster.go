@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// clusterOptions are the keys of a cluster section which are settings rather than servers.
+var clusterOptions = map[string]bool{
+	"clock_offset": true,
+	"domain":       true,
+	"exclude":      true,
+	"include":      true,
+	"logshare":     true,
+	"owners":       true,
+	"password":     true,
+	"suffixes":     true,
+	"retention":    true,
+	"username":     true,
+
+	"files_parallel":           true,
+	"server_rate_limit":        true,
+	"servers_file":             true,
+	"server-name-strip-prefix": true,
+	"server-name-strip-suffix": true,
+}
+
+// loadCluster reads the settings and servers of the cluster called name, which gathers into the
+// window folder below root. With -since-last, its period starts at the end of its previous one.
+// The -suffixes, -owners and -source-clock-offset flags override the settings of the cluster.
+func loadCluster(name, root string, set map[string]bool) *gatherer.Cluster {
+	sect, err := cfg.GetSection(name)
+	if err != nil {
+		fatalf("[fatal] unknown cluster %q", name)
+	}
+	start := clusterStart(name, root)
+	cl := &gatherer.Cluster{
+		Name:        name,
+		Destination: fmt.Sprintf("%s/%s/%s", root, name, folderFmt.Name(name, start, endTime)),
+		Filter:      filter,
+	}
+	cl.Filter.Start, cl.Filter.End, cl.Filter.Grace, cl.Filter.ClockOffset = start, endTime, grace, clockOffset
+	cl.Shares = logShares(sect.Key("logshare").MustString(cfg.Section("default").Key("logshare").Value()))
+	if len(cl.Shares) == 0 {
+		fatalf("[fatal] no logshare configured for cluster %q or in the [default] section", name)
+	}
+	cl.Username = sect.Key("username").MustString(cfg.Section("default").Key("username").Value())
+	cl.Password = sect.Key("password").MustString(cfg.Section("default").Key("password").Value())
+	cl.Domain = sect.Key("domain").MustString(cfg.Section("default").Key("domain").Value())
+	cl.ServerRateLimit, err = gatherer.ParseRate(sect.Key("server_rate_limit").MustString(cfg.Section("default").Key("server_rate_limit").Value()))
+	if err != nil {
+		fatalf("[fatal] cannot limit the servers of cluster %q: %v", name, err)
+	}
+	if len(cl.Username) > 0 {
+		logf("[info] connecting to the log shares of cluster %q as %q", name, cl.Username)
+	}
+
+	suffixes := suffixList
+	if len(suffixes) == 0 {
+		suffixes = sect.Key("suffixes").MustString(cfg.Section("default").Key("suffixes").MustString(".tmp"))
+	}
+	for _, sfx := range strings.Split(suffixes, ",") {
+		if sfx = strings.TrimSpace(sfx); len(sfx) > 0 {
+			cl.Filter.Suffixes = append(cl.Filter.Suffixes, strings.ToLower(sfx))
+		}
+	}
+	if cl.Filter.Include, err = patternList(includeList, sect, "include"); err != nil {
+		fatalf("[fatal] invalid include pattern for cluster %q: %v", name, err)
+	}
+	if cl.Filter.Exclude, err = patternList(excludeList, sect, "exclude"); err != nil {
+		fatalf("[fatal] invalid exclude pattern for cluster %q: %v", name, err)
+	}
+	cl.Parallel = filesParallel
+	if !set["files-parallel"] {
+		cl.Parallel = sect.Key("files_parallel").MustInt(filesParallel)
+	}
+	if cl.Parallel < 1 {
+		fatalf("[fatal] invalid files_parallel %d for cluster %q, must be at least 1", cl.Parallel, name)
+	}
+	if !set["source-clock-offset"] {
+		cl.Filter.ClockOffset = sect.Key("clock_offset").MustDuration(0)
+	}
+	if cl.Filter.ClockOffset != 0 {
+		logf("[info] applying a source clock offset of %s to the period of cluster %q", cl.Filter.ClockOffset, name)
+	}
+	owners := ownerList
+	if len(owners) == 0 {
+		owners = sect.Key("owners").Value()
+	}
+	for _, o := range strings.Split(owners, ",") {
+		if o = strings.TrimSpace(o); len(o) > 0 {
+			if cl.Owners == nil {
+				cl.Owners = make(map[string]bool)
+			}
+			cl.Owners[strings.ToUpper(o)] = true
+		}
+	}
+
+	stripPrefix := sect.Key("server-name-strip-prefix").MustString(cfg.Section("default").Key("server-name-strip-prefix").Value())
+	stripSuffix := sect.Key("server-name-strip-suffix").MustString(cfg.Section("default").Key("server-name-strip-suffix").Value())
+	entries, err := clusterServers(sect)
+	if err != nil {
+		fatalf("[fatal] cannot read the servers_file of cluster %q: %v", name, err)
+	}
+	folders := make(map[string]string)
+	names := make(map[string]bool)
+	for _, e := range entries {
+		srv := parseServer(e, stripPrefix, stripSuffix)
+		if names[srv.Name] {
+			fatalf("[fatal] server %q is listed more than once in cluster %q", srv.Name, name)
+		}
+		names[srv.Name] = true
+		if len(srv.Folder) == 0 {
+			fatalf("[fatal] server %q in cluster %q has an empty destination folder name", srv.Name, name)
+		}
+		if other, ok := folders[strings.ToLower(srv.Folder)]; ok {
+			fatalf("[fatal] servers %q and %q in cluster %q both use destination folder %q", other, srv.Name, name, srv.Folder)
+		}
+		folders[strings.ToLower(srv.Folder)] = srv.Name
+		srv.Cluster = cl
+		cl.Servers = append(cl.Servers, srv)
+	}
+	return cl
+}
+
+// clusterStart returns the start of the period of the cluster called name, which gathers into the
+// window folders below root. With -since-last that is the end of its previous gather, unless it
+// has none or that is not before endTime, which start at startTime like without -since-last.
+func clusterStart(name, root string) time.Time {
+	if !sinceLast {
+		return startTime
+	}
+	last, ok, err := gatherer.LastEnd(fmt.Sprintf("%s/%s", root, name), folderFmt, name)
+	switch {
+	case err != nil:
+		fatalf("[fatal] cannot find the previous gather of cluster %q: %v", name, err)
+	case ok && last.Before(endTime):
+		logf("[info] gathering cluster %q from the end of its previous gather at %s UTC", name, last.Format("2006-01-02 15:04:05"))
+		return last
+	case ok:
+		logf("[warning] the previous gather of cluster %q ends at %s UTC, which is not in the past, gathering the last %s instead", name, last.Format("2006-01-02 15:04:05"), dur)
+	default:
+		logf("[info] cluster %q has no previous gather, gathering the last %s", name, dur)
+	}
+	return startTime
+}
+
+// serverEntry is a server of a cluster, a server key of its section or a line of its
+// servers_file.
+type serverEntry struct {
+	name, value string
+}
+
+// clusterServers returns the servers of the cluster section sect: its server keys followed by
+// the lines of its servers_file, which are "name = host" or just the host, with an optional
+// |alias like a server key. Empty lines and lines starting with # are ignored. A relative
+// servers_file is relative to the folder of the configuration file.
+func clusterServers(sect *ini.Section) ([]serverEntry, error) {
+	var servers []serverEntry
+	for _, k := range sect.Keys() {
+		if !clusterOptions[k.Name()] {
+			servers = append(servers, serverEntry{k.Name(), k.Value()})
+		}
+	}
+	k, err := sect.GetKey("servers_file")
+	if err != nil || len(strings.TrimSpace(k.Value())) == 0 {
+		return servers, nil
+	}
+	path := strings.TrimSpace(k.Value())
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, host, ok := strings.Cut(line, "=")
+		if !ok {
+			host = line
+			name, _, _ = strings.Cut(line, "|")
+		}
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("%s: line %d: no server name in %q", path, i+1, line)
+		}
+		if clusterOptions[name] {
+			return nil, fmt.Errorf("%s: line %d: server %q has the name of a cluster setting", path, i+1, name)
+		}
+		servers = append(servers, serverEntry{name, strings.TrimSpace(host)})
+	}
+	return servers, nil
+}
+
+// logShares returns the log shares of the comma-separated list of a logshare key.
+func logShares(list string) []string {
+	var shares []string
+	for _, logshare := range strings.Split(list, ",") {
+		if logshare = strings.TrimSpace(logshare); len(logshare) > 0 {
+			shares = append(shares, logshare)
+		}
+	}
+	return shares
+}
+
+// parseServer parses a server entry of the form "name = host" or "name = host|alias",
+// where the optional alias is used as destination folder name instead of the key. Without
+// an alias, prefix and suffix are stripped (case-insensitive) from the key to get the folder name.
+func parseServer(e serverEntry, prefix, suffix string) *gatherer.Server {
+	host, alias, _ := strings.Cut(e.value, "|")
+	srv := &gatherer.Server{Name: e.name, Host: strings.TrimSpace(host), Folder: strings.TrimSpace(alias)}
+	if len(srv.Folder) == 0 {
+		srv.Folder = srv.Name
+		if len(prefix) > 0 && strings.HasPrefix(strings.ToLower(srv.Folder), strings.ToLower(prefix)) {
+			srv.Folder = srv.Folder[len(prefix):]
+		}
+		if len(suffix) > 0 && strings.HasSuffix(strings.ToLower(srv.Folder), strings.ToLower(suffix)) {
+			srv.Folder = srv.Folder[:len(srv.Folder)-len(suffix)]
+		}
+	}
+	return srv
+}
+
+// patternList returns the glob patterns of flag or, when it is empty, of the key in sect or the
+// [default] section.
+func patternList(flag string, sect *ini.Section, key string) ([]string, error) {
+	list := flag
+	if len(list) == 0 {
+		list = sect.Key(key).MustString(cfg.Section("default").Key(key).Value())
+	}
+	return gatherer.ParsePatterns(list)
+}
+
+// listClusters writes every cluster of the ini file to w, with its log share and its servers.
+func listClusters(w io.Writer) {
+	for _, name := range clusterNames("all") {
+		sect := cfg.Section(name)
+		fmt.Fprintf(w, "[%s]\n", name)
+		fmt.Fprintf(w, "  logshare = %s\n", sect.Key("logshare").MustString(cfg.Section("default").Key("logshare").Value()))
+		servers, err := clusterServers(sect)
+		if err != nil {
+			fmt.Fprintf(w, "  ; cannot read servers_file: %v\n", err)
+		}
+		for _, e := range servers {
+			fmt.Fprintf(w, "  %s = %s\n", e.name, e.value)
+		}
+	}
+}
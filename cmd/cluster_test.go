@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+func TestClusterStart(t *testing.T) {
+	defer func(s, e time.Time, d time.Duration, f *gatherer.FolderFormat, l bool) {
+		startTime, endTime, dur, folderFmt, sinceLast = s, e, d, f, l
+	}(startTime, endTime, dur, folderFmt, sinceLast)
+	var err error
+	if folderFmt, err = gatherer.ParseFolderFormat(gatherer.DefaultFolderFormat); err != nil {
+		t.Fatal(err)
+	}
+	endTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dur = time.Hour
+	startTime = endTime.Add(-dur)
+	window := func(cluster string, end time.Time) string {
+		return filepath.Join(cluster, folderFmt.Name(cluster, end.Add(-time.Hour), end))
+	}
+	previous := endTime.Add(-3 * time.Hour)
+
+	tests := []struct {
+		name      string
+		sinceLast bool
+		folders   []string
+		want      time.Time
+	}{
+		{"without -since-last", false, []string{window("web", previous)}, startTime},
+		{"no previous gather", true, nil, startTime},
+		{"previous gather", true, []string{window("web", previous)}, previous},
+		{"latest of several", true, []string{window("web", previous.Add(-time.Hour)), window("web", previous)}, previous},
+		{"previous gather of another cluster", true, []string{window("app", previous)}, startTime},
+		{"not a window folder", true, []string{filepath.Join("web", "notes")}, startTime},
+		{"previous gather ends at the end", true, []string{window("web", endTime)}, startTime},
+		{"previous gather ends later", true, []string{window("web", endTime.Add(time.Hour))}, startTime},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		for _, f := range tt.folders {
+			if err := os.MkdirAll(filepath.Join(root, f), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sinceLast = tt.sinceLast
+		if got := clusterStart("web", filepath.ToSlash(root)); !got.Equal(tt.want) {
+			t.Errorf("%s: clusterStart = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// settings of loading the configuration from an http or https -config URL, which can only be
+// given as flags or in the environment, as they are needed before the configuration is loaded
+var (
+	configTimeout time.Duration
+	configHeader  string // "Name: value", such as an Authorization header
+	configCache   string // copy of the last configuration downloaded, next to the executable by default
+)
+
+// isConfigURL reports whether the -config path is an http or https URL to download it from.
+func isConfigURL(path string) bool {
+	p := strings.ToLower(path)
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// loadConfigURL loads the configuration at the http or https URL rawURL, as YAML when its path
+// ends in .yaml or .yml, and saves a copy of it in the -config-cache file. When it cannot be
+// downloaded, the copy of an earlier run is loaded instead, which is logged. An error is only
+// returned when neither is available, the configuration cannot be parsed or the -config-header
+// is invalid. Relative paths in the configuration are relative to the folder of the cache file.
+func loadConfigURL(rawURL string) (*ini.File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration URL: %v", err)
+	}
+	if len(configHeader) > 0 {
+		name, _, ok := strings.Cut(configHeader, ":")
+		if name = strings.TrimSpace(name); !ok || len(name) == 0 || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid -config-header %q, expected Name: value", configHeader)
+		}
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext != ".yaml" && ext != ".yml" {
+		ext = ".ini"
+	}
+	cache := configCache
+	if len(cache) == 0 {
+		cache = fmt.Sprintf("%s.cache%s", ep, ext)
+	}
+	configDir = filepath.Dir(cache)
+	u.User = nil // only used for the logged messages and errors, which must not show a password
+
+	data, err := fetchConfig(rawURL)
+	if err == nil {
+		var f *ini.File
+		if f, err = parseConfig(u.String(), ext, data); err != nil {
+			return nil, err
+		}
+		// the copy is only replaced by a configuration which can be parsed
+		if err := writeCache(cache, data); err != nil {
+			logf("[warning] cannot save a copy of the configuration in %q: %v", fileName(cache), err)
+		}
+		return f, nil
+	}
+	cached, cerr := os.ReadFile(cache)
+	if cerr != nil {
+		return nil, fmt.Errorf("cannot download the configuration from %s (%v) and there is no copy of an earlier one: %v", u, err, cerr)
+	}
+	logf("[warning] cannot download the configuration from %s, using the copy in %q instead: %v", u, fileName(cache), err)
+	return parseConfig(cache, ext, cached)
+}
+
+// fetchConfig downloads the configuration at rawURL with the -config-header, within the
+// -config-timeout.
+func fetchConfig(rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), configTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(configHeader) > 0 {
+		name, value, _ := strings.Cut(configHeader, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server responded with %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseConfig parses the configuration data downloaded from name, as YAML for the extension
+// .yaml or .yml and as ini file otherwise.
+func parseConfig(name, ext string, data []byte) (*ini.File, error) {
+	if ext == ".yaml" || ext == ".yml" {
+		return parseYAML(name, data)
+	}
+	f, err := ini.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// writeCache replaces the cached configuration at name with data. It is written next to it
+// first, so a run reading it at the same time never sees half of it, and only readable by the
+// owner, as it may well hold passwords.
+func writeCache(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
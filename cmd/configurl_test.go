@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigURL(t *testing.T) {
+	defer func(d, c, h string, tm time.Duration) {
+		configDir, configCache, configHeader, configTimeout = d, c, h, tm
+	}(configDir, configCache, configHeader, configTimeout)
+	configHeader, configTimeout = "Authorization: Bearer secret", 100*time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/loggatherer.ini":
+			w.Write([]byte("[default]\ndestination = served\n"))
+		case "/loggatherer.yaml":
+			w.Write([]byte("default:\n  destination: served\n"))
+		case "/broken.ini":
+			w.Write([]byte("[default\n"))
+		case "/slow.ini":
+			time.Sleep(300 * time.Millisecond) // thrice the -config-timeout
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		cached string // configuration saved by an earlier run, none when empty
+		want   string // destination loaded, an error when empty
+		keep   bool   // whether the cached configuration must be left alone
+	}{
+		{"ini", "/loggatherer.ini", configHeader, "", "served", false},
+		{"replaces the copy", "/loggatherer.ini", configHeader, "[default]\ndestination = cached\n", "served", false},
+		{"yaml", "/loggatherer.yaml", configHeader, "", "served", false},
+		{"not found, copy", "/missing.ini", configHeader, "[default]\ndestination = cached\n", "cached", true},
+		{"not found, no copy", "/missing.ini", configHeader, "", "", true},
+		{"unauthorized, copy", "/loggatherer.ini", "Authorization: Bearer wrong", "[default]\ndestination = cached\n", "cached", true},
+		{"timeout, copy", "/slow.ini", configHeader, "[default]\ndestination = cached\n", "cached", true},
+		{"invalid header", "/loggatherer.ini", "Bearer secret", "[default]\ndestination = cached\n", "", true},
+		{"cannot parse", "/broken.ini", configHeader, "[default]\ndestination = cached\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configCache = filepath.Join(dir, "cached"+filepath.Ext(tt.path))
+			if len(tt.cached) > 0 {
+				if err := os.WriteFile(configCache, []byte(tt.cached), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer func(h string) { configHeader = h }(configHeader)
+			configHeader = tt.header
+
+			f, err := loadConfigURL(srv.URL + tt.path)
+			if len(tt.want) == 0 {
+				if err == nil {
+					t.Fatalf("loaded destination %q, want an error", f.Section("default").Key("destination").Value())
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got := f.Section("default").Key("destination").Value(); got != tt.want {
+				t.Errorf("loaded destination %q, want %q", got, tt.want)
+			} else if configDir != dir {
+				t.Errorf("relative paths are relative to %q, want the folder of the copy %q", configDir, dir)
+			}
+
+			data, err := os.ReadFile(configCache)
+			switch {
+			case tt.keep && len(tt.cached) == 0:
+				if err == nil {
+					t.Errorf("copy %q saved, want none", data)
+				}
+			case tt.keep:
+				if string(data) != tt.cached {
+					t.Errorf("copy %q, want the one of the earlier run %q", data, tt.cached)
+				}
+			case err != nil:
+				t.Errorf("no copy saved: %v", err)
+			case len(data) == 0 || string(data) == tt.cached:
+				t.Errorf("copy %q, want the downloaded configuration", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// hookEnv returns the environment of the hooks of a gather of clusters into destination: that of
+// this process plus the LOGGATHERER_ variables describing the gather.
+func hookEnv(destination string, clusters []*gatherer.Cluster) []string {
+	var names, folders []string
+	for _, cl := range clusters {
+		names = append(names, cl.Name)
+		folders = append(folders, cl.Destination)
+	}
+	return append(os.Environ(),
+		"LOGGATHERER_DESTINATION="+destination,
+		"LOGGATHERER_CLUSTERS="+strings.Join(names, ","),
+		// the window folders of the clusters, separated like the folders of PATH
+		"LOGGATHERER_FOLDERS="+strings.Join(folders, string(os.PathListSeparator)),
+		"LOGGATHERER_START="+startTime.Format(time.RFC3339),
+		"LOGGATHERER_END="+endTime.Format(time.RFC3339),
+	)
+}
+
+// summaryEnv returns the variables describing the result and statistics of the gather to add to
+// hookEnv for the post_hook.
+func summaryEnv(result outcome, stats gatherer.Stats) []string {
+	t := stats.Totals()
+	return []string{
+		"LOGGATHERER_RESULT=" + string(result),
+		"LOGGATHERER_EXIT_CODE=" + strconv.Itoa(result.exitCode(stats.DestinationFull)),
+		"LOGGATHERER_MATCHED=" + strconv.Itoa(t.Matched),
+		"LOGGATHERER_COPIED=" + strconv.Itoa(t.Copied),
+		"LOGGATHERER_ERRORS=" + strconv.Itoa(t.Errors),
+		"LOGGATHERER_BYTES_READ=" + strconv.FormatInt(t.Read, 10),
+		"LOGGATHERER_BYTES_WRITTEN=" + strconv.FormatInt(t.Written, 10),
+	}
+}
+
+// runHook runs the command line of the key of the [default] section through the shell, with
+// the environment env, and logs its output. It returns whether the hook succeeded, which it also
+// does when no hook is configured. In the ini file, a command containing ; or # has to be put in
+// backquotes, as those would otherwise start a comment.
+func runHook(ctx context.Context, key string, env []string) bool {
+	command := strings.TrimSpace(cfg.Section("default").Key(key).Value())
+	if len(command) == 0 {
+		return true
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = env
+	logf("[info] running %s %q", key, command)
+	out, err := cmd.CombinedOutput()
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		logf("[info][%s] %s", key, sc.Text())
+	}
+	if err != nil {
+		logf("[error] %s %q failed: %v", key, command, err)
+		return false
+	}
+	return true
+}
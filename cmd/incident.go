@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// lookupIncident returns the start time of the incident called name and its duration, which
+// is zero when the incident does not define one. Incidents are sections of the ini file named
+// by the incidents key of the [default] section, relative to the folder of the configuration
+// file (default: incidents.ini next to it), each with a start key in the same format as -start
+// and an optional duration key.
+func lookupIncident(name string) (string, time.Duration, error) {
+	path := cfg.Section("default").Key("incidents").MustString("incidents.ini")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	incidents, err := ini.Load(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot open incidents file: %v", err)
+	}
+	sect, err := incidents.GetSection(name)
+	if err != nil || name == ini.DefaultSection {
+		var names []string
+		for _, s := range incidents.Sections() {
+			if s.Name() != ini.DefaultSection {
+				names = append(names, s.Name())
+			}
+		}
+		sort.Strings(names)
+		return "", 0, fmt.Errorf("unknown incident %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	start := sect.Key("start").Value()
+	if len(start) == 0 {
+		return "", 0, fmt.Errorf("incident %q has no start time", name)
+	}
+	d, err := time.ParseDuration(sect.Key("duration").MustString("0s"))
+	if err != nil {
+		return "", 0, fmt.Errorf("incident %q has an invalid duration: %v", name, err)
+	}
+	return start, d, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interrupted is set once the gather was stopped by SIGINT or SIGTERM.
+var interrupted int32
+
+// handleInterrupt cancels the gather on the first SIGINT or SIGTERM, after which the copies in
+// progress are abandoned and no new ones are started. A second signal exits immediately.
+func handleInterrupt(cancel context.CancelFunc) {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		logf("[info] received %s, stopping the gather", sig)
+		fmt.Fprintf(os.Stderr, "received %s, stopping the gather (send it again to exit immediately)\n", sig)
+		atomic.StoreInt32(&interrupted, 1)
+		cancel()
+		// paused copies have to see the cancellation too
+		gate.set(false)
+		sig = <-c
+		logf("[fatal] received %s again, exiting", sig)
+		releaseLocks()
+		os.Exit(exitInterrupted)
+	}()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// lockName is the name of the lock file of a run in the folder of each of its clusters.
+const lockName = ".lock"
+
+var (
+	lockRetry = 5 * time.Second // how often a locked cluster is tried again with -wait-lock
+
+	locksMu sync.Mutex
+	locks   []string // lock files taken by lockClusters
+)
+
+// lockClusters creates the lock file of every cluster below destination, so overlapping runs
+// never write into the same window folders. A lock older than -lock-max-age is left by a run
+// which crashed and is removed. When a cluster is locked by another run, it waits for it with
+// -wait-lock until ctx is done, otherwise it releases the locks taken and returns false, and
+// whether that is because the destination is full. The locks are removed by releaseLocks.
+func lockClusters(ctx context.Context, destination string, clusters []*gatherer.Cluster) (ok, destFull bool) {
+	host, _ := os.Hostname()
+	for _, cl := range clusters {
+		dir := fmt.Sprintf("%s/%s", destination, cl.Name)
+		if err := gatherer.CreateFolder(dir, dirMode); err != nil {
+			logf("[error] cannot lock cluster %q: %v", cl.Name, err)
+			releaseLocks()
+			return false, gatherer.IsDiskFull(err)
+		}
+		path := fmt.Sprintf("%s/%s", dir, lockName)
+		for waiting := false; ; {
+			err := createLock(path, fmt.Sprintf("pid %d on %s since %s\n", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339)))
+			if err == nil {
+				locksMu.Lock()
+				locks = append(locks, path)
+				locksMu.Unlock()
+				break
+			}
+			if !errors.Is(err, os.ErrExist) {
+				logf("[error] cannot lock cluster %q: %v", cl.Name, err)
+				releaseLocks()
+				return false, false
+			}
+			owner, _ := os.ReadFile(path)
+			if finfo, err := os.Stat(path); err == nil && lockMaxAge > 0 && time.Since(finfo.ModTime()) > lockMaxAge {
+				logf("[warning] removing the lock of cluster %q older than %s, left by %s", cl.Name, lockMaxAge, strings.TrimSpace(string(owner)))
+				os.Remove(path)
+				continue
+			}
+			if !waitLock {
+				logf("[error] another run is in progress for cluster %q, %s (lock %q)", cl.Name, strings.TrimSpace(string(owner)), fileName(path))
+				releaseLocks()
+				return false, false
+			}
+			if !waiting {
+				logf("[info] waiting for the run in progress for cluster %q, %s", cl.Name, strings.TrimSpace(string(owner)))
+				waiting = true
+			}
+			select {
+			case <-ctx.Done():
+				logf("[error] gave up waiting for the run in progress for cluster %q", cl.Name)
+				releaseLocks()
+				return false, false
+			case <-time.After(lockRetry):
+			}
+		}
+	}
+	return true, false
+}
+
+// releaseLocks removes the locks taken by lockClusters. It is called on every way out of a run,
+// including fatalf and a second interrupt, so a failed run never blocks the next one.
+func releaseLocks() {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	for _, path := range locks {
+		if err := os.Remove(path); err != nil {
+			logf("[error] cannot remove lock %q: %v", fileName(path), err)
+		}
+	}
+	locks = nil
+}
+
+// createLock creates the lock file at path holding owner, failing with os.ErrExist when it
+// exists already.
+func createLock(path, owner string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(owner)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+func TestLockClusters(t *testing.T) {
+	defer func(w bool, a, r time.Duration, d, f os.FileMode) {
+		waitLock, lockMaxAge, lockRetry, dirMode, fileMode = w, a, r, d, f
+	}(waitLock, lockMaxAge, lockRetry, dirMode, fileMode)
+	dirMode, fileMode, lockRetry = 0755, 0644, 10*time.Millisecond
+
+	tests := []struct {
+		name       string
+		locked     time.Duration // age of the lock another run holds on cluster web, none when 0
+		maxAge     time.Duration
+		wait       bool
+		released   time.Duration // when the other run removes its lock, never when 0
+		ok         bool
+		stillOwned bool // whether the lock of the other run is still there
+	}{
+		{"not locked", 0, 0, false, 0, true, false},
+		{"locked", time.Minute, 0, false, 0, false, true},
+		{"locked, not stale yet", time.Minute, time.Hour, false, 0, false, true},
+		{"stale lock", 2 * time.Hour, time.Hour, false, 0, true, false},
+		{"waiting in vain", time.Minute, 0, true, 0, false, true},
+		{"waiting until released", time.Minute, 0, true, 30 * time.Millisecond, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer releaseLocks()
+			dest := t.TempDir()
+			other := filepath.Join(dest, "web", lockName)
+			if tt.locked > 0 {
+				if err := os.MkdirAll(filepath.Dir(other), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(other, []byte("pid 1 on other\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := time.Now().Add(-tt.locked)
+				if err := os.Chtimes(other, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.released > 0 {
+				timer := time.AfterFunc(tt.released, func() { os.Remove(other) })
+				defer timer.Stop()
+			}
+			waitLock, lockMaxAge = tt.wait, tt.maxAge
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			clusters := []*gatherer.Cluster{{Name: "app"}, {Name: "web"}}
+			ok, full := lockClusters(ctx, filepath.ToSlash(dest), clusters)
+			if ok != tt.ok || full {
+				t.Fatalf("lockClusters = %t, %t, want %t, false", ok, full, tt.ok)
+			}
+			owner, err := os.ReadFile(other)
+			if owned := err == nil && string(owner) == "pid 1 on other\n"; owned != tt.stillOwned {
+				t.Errorf("lock of the other run still there %t, want %t", owned, tt.stillOwned)
+			}
+			// a run which cannot lock every cluster holds none of them
+			_, err = os.Stat(filepath.Join(dest, "app", lockName))
+			if locked := err == nil; locked != tt.ok {
+				t.Errorf("cluster app locked %t, want %t", locked, tt.ok)
+			}
+			releaseLocks()
+			if _, err := os.Stat(filepath.Join(dest, "app", lockName)); err == nil {
+				t.Errorf("lock of cluster app left behind by releaseLocks")
+			}
+			if _, err := os.Stat(other); (err == nil) != tt.stillOwned {
+				t.Errorf("lock of cluster web there %t after releaseLocks, want %t", err == nil, tt.stillOwned)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// logFormat is the format of the log output, text or json.
+var logFormat = "text"
+
+// log levels, messages below logLevel are not logged
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarning
+	levelError
+)
+
+var logLevel = levelInfo
+
+// levels maps the level in the prefix of a message to its log level. Messages without a known
+// level are info messages.
+var levels = map[string]int{
+	"debug":   levelDebug,
+	"info":    levelInfo,
+	"warning": levelWarning,
+	"error":   levelError,
+	"fatal":   levelError,
+}
+
+// fileName marks a logged argument as the name or path of a file, which is reported in the
+// file field of json log output. The gather logs its files with the same type.
+type fileName = gatherer.FileName
+
+// logEntry is a single line of json log output.
+type logEntry struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Server string `json:"server,omitempty"`
+	File   string `json:"file,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Msg    string `json:"msg"`
+}
+
+// logPrefix matches the "[level]" or "[level][server]" prefix of log messages.
+var logPrefix = regexp.MustCompile(`^\[(\w+)\](?:\[([^\]]*)\])? ?`)
+
+// logf logs a message like log.Printf, unless its level is below logLevel. The text format
+// logs it unchanged, the json format logs the level and server of its prefix, the first
+// fileName and error argument and the rest of the message as separate fields.
+func logf(format string, args ...interface{}) {
+	level := levelInfo
+	if m := logPrefix.FindStringSubmatch(format); m != nil {
+		if l, ok := levels[m[1]]; ok {
+			level = l
+		}
+	}
+	if level < logLevel {
+		return
+	}
+	reportf(format, args...)
+}
+
+// reportf logs a message like logf, regardless of logLevel. It is used for the summary.
+func reportf(format string, args ...interface{}) {
+	if logFormat != "json" {
+		log.Printf(format, args...)
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	e := logEntry{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: "info", Msg: msg}
+	if m := logPrefix.FindStringSubmatch(msg); m != nil {
+		e.Level, e.Server, e.Msg = m[1], m[2], msg[len(m[0]):]
+	}
+	for _, a := range args {
+		switch a := a.(type) {
+		case fileName:
+			if len(e.File) == 0 {
+				e.File = string(a)
+			}
+		case error:
+			if len(e.Error) == 0 && a != nil {
+				e.Error = a.Error()
+			}
+		}
+	}
+	b, _ := json.Marshal(e)
+	log.Print(string(b))
+}
+
+// fatalf logs a message like logf, reports the run as a configuration error in the summary,
+// the notification, the metrics and the JSON report, removes its locks and exits with
+// exitConfigError.
+func fatalf(format string, args ...interface{}) {
+	logf(format, args...)
+	logSummary(outcomeConfigError, gatherer.Stats{}, time.Since(began))
+	reportRun(runClusters, gatherer.Stats{}, outcomeConfigError, exitConfigError, time.Since(began))
+	releaseLocks()
+	os.Exit(exitConfigError)
+}
+
+// setLogFormat selects the format of the log output.
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+	case "json":
+		// the time is part of the json entry
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("invalid -log-format %q, expected text or json", format)
+	}
+	logFormat = format
+	return nil
+}
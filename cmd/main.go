@@ -1,7 +1,7 @@
 package main
 
 import (
-	"compress/gzip"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,243 +9,1025 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
-	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/mvanwaaijen/execpath"
 	"gopkg.in/ini.v1"
+
+	"ipsos.com/utils/loggatherer/gatherer"
 )
 
 var (
-	start     string
-	dur       time.Duration
-	cfg       *ini.File
-	cluster   string
-	startTime time.Time
-	endTime   time.Time
-	compress  bool
-	clean     bool
-	showver   bool
-	ep        string
+	start       string
+	end         string
+	dur         time.Duration
+	cfg         *ini.File
+	configDir   string // folder of the configuration file
+	cluster     string
+	startTime   time.Time
+	endTime     time.Time
+	compress    bool
+	compressMin int64
+	clean       bool
+	keepLast    int
+	maxTotal    int64 // 0 means no limit
+	folderFmt   *gatherer.FolderFormat
+	showver     bool
+	listConfig  bool
+	sinceLast   bool
+	dedup       bool
+	newest      int
+	output      string
+	serverName  string
+	decompress  bool
+	dirMode     os.FileMode
+	fileMode    os.FileMode
+	waitLock    bool
+	lockMaxAge  time.Duration
+	force       bool
+	hookFatal   bool
+	notifyURL   string
+	notifyOn    string
+	metricsFile string
+	reportJSON  string
+	followLinks bool
+	noClobber   bool
+	fileList    string
+	retryFailed bool
+	traceIO     bool
+	grace       time.Duration
+	verifyDir   string
+	verifyCopy  string
+	requireVer  bool
+	repair      bool
+	profile     string
+	purge       bool
+	purgeMinAge time.Duration
+	incident    string
+	listOnly    bool
+	listFormat  string
+	mtimeFrom   string
+	recompress  bool
+	ownerList   string
+	clockOffset time.Duration
+	combine     string
+	combineMax  int64
+	suffixList  string
+	includeList string
+	excludeList string
+	filter      gatherer.Filter // filter settings shared by all clusters
+	parallel    int
+	dryRun      bool
+	recursive   bool
+	manifestFmt string
+	ep          string
+	failFast    bool
+
+	serverTimeout time.Duration
+	runTimeout    time.Duration
+	skipExisting  bool
+	onExists      string
+	filesParallel int
+	compressLevel int
+	outputFormat  string
+	preserveOwner bool
+	progressEvery time.Duration
+	skipMode      string
+
+	began       time.Time           // when the run started
+	runClusters []*gatherer.Cluster // the clusters of the run, once they are loaded
+)
+
+// exit codes
+const (
+	exitConfigError     = 1 // also used by every fatalf
+	exitDestinationFull = 3
+	exitPartial         = 4
+	exitEmpty           = 5
+	exitAborted         = 6
+	exitInterrupted     = 7
+	exitHookFailed      = 8
+	exitLocked          = 9 // another run is gathering one of the clusters
+	exitUnverified      = 10
 )
 
 //go:generate genver.exe
 
-func init() {
+// loadConfig loads the ini file at path, or the one next to the executable when path is empty.
+// A path ending in .yaml or .yml is loaded as YAML instead, see loadYAML, and an http or https
+// URL is downloaded, see loadConfigURL. It is called from main rather than init so that test
+// binaries can run without one.
+func loadConfig(path string) error {
 	var err error
 	ep, _ = execpath.Get()
-	cfg, err = ini.Load(fmt.Sprintf("%s.ini", ep))
-	if err != nil {
-		log.Fatalf("[fatal] cannot open ini file: %v", err)
+	if len(path) == 0 {
+		path = fmt.Sprintf("%s.ini", ep)
+	}
+	if isConfigURL(path) {
+		cfg, err = loadConfigURL(path)
+		return err
 	}
+	configDir = filepath.Dir(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		cfg, err = loadYAML(path)
+	default:
+		cfg, err = ini.Load(path)
+	}
+	return err
 }
 
 func main() {
 	var err error
 
+	began = time.Now()
+
 	wd, _ := execpath.GetDir()
+	var (
+		configFile, levelName, logFile string
+		minSizeArg, maxSizeArg         string
+		compressMinArg                 string
+		maxTotalArg, rateArg           string
+		dirModeArg, fileModeArg        string
+		verbose, quiet, localStart     bool
+		deterministic                  bool
+		tzName                         string
+		notifyTmplArg, notifyHdrArg    string
+	)
 	defaultDuration, _ := time.ParseDuration("1h")
-	dur = cfg.Section("default").Key("duration").MustDuration(defaultDuration)
+	flag.StringVar(&configFile, "config", os.Getenv("LOGGATHERER_CONFIG"), "ini or YAML (.yaml, .yml) `file` to load, or an http or https URL to download it from (default: $LOGGATHERER_CONFIG, or the .ini file next to the executable)")
+	flag.DurationVar(&configTimeout, "config-timeout", 10*time.Second, "how long downloading a -config URL may take")
+	flag.StringVar(&configHeader, "config-header", os.Getenv("LOGGATHERER_CONFIG_HEADER"), "header to download a -config URL with, such as \"Authorization: Bearer <token>\" (default: $LOGGATHERER_CONFIG_HEADER)")
+	flag.StringVar(&configCache, "config-cache", "", "`file` to keep a copy of the configuration downloaded from a -config URL in, which is loaded when the download fails (default: the .cache.ini or .cache.yaml file next to the executable)")
 	// flag.StringVar(&start, "start", time.Now().Add(-1*dur).UTC().Format("2006-01-02 15:04:05"), "time in UTC (yyyy-MM-dd HH:mm:ss) from when you want to start collecting the logs")
-	flag.StringVar(&start, "start", "", "time in UTC (yyyy-MM-dd HH:mm:ss) from when you want to start collecting the logs (default: current UTC time - duration)")
-	flag.DurationVar(&dur, "duration", dur, "duration of the period you want to have the logs for (1h = 1 hour, 15m = 15 minutes, etc)")
-	flag.StringVar(&cluster, "cluster", cfg.Section("default").Key("cluster").Value(), "cluster to gather logs from")
-	flag.BoolVar(&compress, "compress", false, "gzip compress the individual log files")
-	flag.BoolVar(&clean, "clean", false, "clean up any log folders for the specified cluster which are older than the specified duration")
+	flag.StringVar(&start, "start", "", "time in UTC, or the zone of -local or -tz, (yyyy-MM-dd HH:mm:ss) from when you want to start collecting the logs, or relative to now such as -2h, today 09:00 or yesterday (default: current UTC time - duration)")
+	flag.StringVar(&end, "end", "", "end of the period to collect the logs for, in the format of -start, instead of -duration (default: start + duration)")
+	flag.BoolVar(&localStart, "local", false, "parse -start in the local time zone of this machine instead of UTC")
+	flag.StringVar(&tzName, "tz", "", "parse -start in this IANA time `zone`, such as Europe/Amsterdam, instead of UTC")
+	flag.BoolVar(&sinceLast, "since-last", false, "gather each cluster from the end of its most recent window folder up to now, or the last duration when it has none, instead of using -start")
+	flag.StringVar(&incident, "incident", "", "gather the period of this incident from the incidents file instead of using -start")
+	flag.DurationVar(&dur, "duration", 0, "duration of the period you want to have the logs for (1h = 1 hour, 15m = 15 minutes, etc) (default: the duration key, or 1h)")
+	flag.StringVar(&cluster, "cluster", "", "comma-separated clusters to gather logs from, or \"all\" (default: the cluster key)")
+	flag.DurationVar(&clockOffset, "source-clock-offset", 0, "how far the clocks of the servers run ahead of this machine (negative when behind) (default: the cluster's clock_offset key)")
+	flag.StringVar(&suffixList, "suffixes", "", "comma-separated file name suffixes to gather (default: the suffixes key of the cluster or [default] section, or .tmp)")
+	flag.StringVar(&dirModeArg, "dir-mode", "", "octal permissions of the folders created in the destination (default: the dir_mode key, or 0755)")
+	flag.StringVar(&fileModeArg, "file-mode", "", "octal permissions of the files created, before copies get those of their source (default: the file_mode key, or 0644)")
+	flag.StringVar(&minSizeArg, "min-size", "", "only gather files of at least this size, such as 1KB (default: the min_size key, or 0)")
+	flag.StringVar(&maxSizeArg, "max-size", "", "only gather files of at most this size, such as 10MB (default: the max_size key, or no limit)")
+	flag.BoolVar(&filter.SkipEmpty, "skip-empty", false, "do not gather empty files (default: the skip_empty key)")
+	flag.StringVar(&includeList, "include", "", "only gather files whose name matches one of these comma-separated glob patterns (default: the include key of the cluster or [default] section)")
+	flag.StringVar(&excludeList, "exclude", "", "never gather files whose name matches one of these comma-separated glob patterns (default: the exclude key of the cluster or [default] section)")
+	flag.DurationVar(&grace, "grace", 0, "also include files up to this long after the end of the period (the folder name keeps the nominal period)")
+	flag.StringVar(&filter.TimeField, "time-field", "overlap", "time that decides whether a file belongs to the period: mtime (modified within it), ctime (created within it) or overlap (created before its end and modified after its start)")
+	flag.StringVar(&rateArg, "rate-limit", "", "cap the total read throughput of all copies, such as 20MB/s (default: the rate_limit key, or no limit)")
+	flag.IntVar(&parallel, "parallel", 0, "maximum number of servers to gather from at the same time (default: the max_parallel key, or the number of CPUs)")
+	flag.IntVar(&filesParallel, "files-parallel", 0, "maximum number of files to copy from a single server at the same time (default: the files_parallel key of the cluster or [default] section, or 1)")
+	flag.BoolVar(&compress, "compress", false, "gzip compress the individual log files (same as -format gzip)")
+	flag.StringVar(&outputFormat, "format", "none", "output format: none, gzip or zstd to compress the individual log files, or zip or tar.gz for a single <server>.zip or <server>.tar.gz archive")
+	flag.StringVar(&levelName, "compress-level", "", "compression level, 1 (BestSpeed) to 9 (BestCompression) (default: the compress_level key, or DefaultCompression)")
+	flag.BoolVar(&recompress, "recompress", false, "decompress gzipped source files and compress them again instead of copying them as-is")
+	flag.StringVar(&compressMinArg, "compress-min-size", "", "only compress files of at least this size, such as 4KB, smaller files are copied as-is (default: the compress_min_size key, or 0)")
+	flag.BoolVar(&clean, "clean", false, "clean up any log folders for the specified clusters (comma-separated or all) which are older than the specified duration or the cluster's retention")
+	flag.IntVar(&keepLast, "keep", 0, "with -clean, always keep this many of the most recent log folders per cluster, whatever their age (default: the keep_last key)")
+	flag.StringVar(&maxTotalArg, "max-total-size", "", "with -clean, also remove the oldest log folders of the clusters until they use at most this much space, such as 500GB (default: the max_total_size key, or no limit)")
+	flag.BoolVar(&dryRun, "dry-run", false, "only log which files would be copied or which folders would be cleaned up, without writing anything")
+	flag.BoolVar(&recursive, "recursive", false, "also gather files in the subfolders of the log share, keeping their relative paths (default: the recursive key)")
+	flag.BoolVar(&followLinks, "follow-symlinks", false, "gather the targets of symbolic links and junctions in the log share instead of skipping them (default: the follow_symlinks key)")
+	flag.BoolVar(&waitLock, "wait-lock", false, "wait for another run gathering one of the clusters to finish, instead of exiting")
+	flag.DurationVar(&lockMaxAge, "lock-max-age", 0, "remove the lock of a cluster left by a run which crashed once it is this old, never when 0 (default: the lock_max_age key, or 24h)")
+	flag.StringVar(&serverName, "server", "", "only gather from the server with this name, the key of its cluster section")
+	flag.StringVar(&output, "output", "", "with - and -server, write the newest matching file of the server to stdout instead of gathering into the destination")
+	flag.BoolVar(&decompress, "decompress", false, "decompress the file written by -output - when it is gzip compressed")
+	flag.BoolVar(&listOnly, "list-only", false, "write a listing of the matching files per server to the destination instead of copying them")
+	flag.StringVar(&listFormat, "list-format", "csv", "format of the -list-only listings (csv or json)")
+	flag.StringVar(&manifestFmt, "manifest", "none", "write a manifest of every gathered file into the window folder of each cluster (none, csv or json)")
+	flag.StringVar(&mtimeFrom, "output-mtime-from", "source-mtime", "modification time to set on copied files (source-mtime, source-ctime or now)")
+	flag.StringVar(&ownerList, "owners", "", "only gather files owned by one of these comma-separated SIDs (Windows) or uids (default: the cluster's owners key)")
+	flag.StringVar(&combine, "combine", "", "write the lines of all matching text logs of a server into a single <server>.ndjson file (ndjson)")
+	flag.Int64Var(&combineMax, "combine-max-size", 64<<20, "size in bytes above which files are copied instead of combined")
+	flag.BoolVar(&noClobber, "no-clobber-newer", false, "never overwrite a destination file which is newer than its source")
+	flag.BoolVar(&skipExisting, "skip-existing", false, "skip files whose copy already exists with the same size and modification time (only the modification time for compressed copies)")
+	flag.IntVar(&newest, "newest", 0, "only gather the N most recently modified matching files of each log share of a server; without -start, -end, -duration, -incident or -since-last the files of any time are considered")
+	flag.BoolVar(&preserveOwner, "preserve-owner", false, "give the copies the owner and group of their source, when running as root on Unix (default: the preserve_owner key)")
+	flag.BoolVar(&dedup, "dedup", false, "store identical copies in a window folder once, below its .blobs folder, and hard link the copies of each server to them (default: the dedup key)")
+	flag.StringVar(&skipMode, "skip-mode", "mtime", "how -skip-existing decides a file was copied before: mtime compares the modification time and size of the copy, hash the digest of the source to the one in the manifest of the window folder (default: the skip_mode key, or mtime)")
+	flag.StringVar(&onExists, "on-exists", "overwrite", "what to do when the copy of a file already exists: overwrite it, skip the file, or rename the new copy with a numeric suffix (default: the on_exists key, or overwrite)")
+	flag.StringVar(&fileList, "files", "", "file with server:path lines (path relative to the log share) to copy regardless of the time window")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "copy only the files listed in the failed.txt of the window folder, which could not be read by an earlier run of the same period")
+	flag.BoolVar(&force, "force", false, "gather even when the destination does not seem to have enough free space for it")
+	flag.BoolVar(&hookFatal, "hook-fatal", false, "fail the run when the pre_hook or post_hook command exits with an error, instead of only logging it")
+	flag.StringVar(&notifyURL, "notify-url", "", "POST a JSON summary of the gather to this `URL`, such as a Slack incoming webhook, when it ends (default: the notify_url key)")
+	flag.StringVar(&notifyOn, "notify-on", "always", "when to send the -notify-url notification: always, or only on failure (default: the notify_on key, or always)")
+	flag.StringVar(&notifyTmplArg, "notify-template", "", "body of the -notify-url notification: the preset generic-json or slack, or a text/template `file` rendered with the result of the gather (default: the notify_template key, or generic-json)")
+	flag.StringVar(&notifyHdrArg, "notify-headers", "", "comma-separated \"Name: value\" headers to send with the -notify-url notification, such as an Authorization header (default: the notify_headers key)")
+	flag.StringVar(&reportJSON, "report-json", "", "write the result and statistics of the run to this JSON `file` (default: the report_json key)")
+	flag.StringVar(&metricsFile, "metrics-file", "", "write the statistics of the run to this .prom `file` for the textfile collector of the Prometheus node_exporter (default: the metrics_file key)")
+	flag.BoolVar(&failFast, "fail-fast", false, "stop the whole gather at the first error instead of continuing with the other files and servers")
+	flag.DurationVar(&runTimeout, "timeout", 0, "abandon all remaining copies once the gather has been running for this long (default: the timeout key, or no limit)")
+	flag.DurationVar(&serverTimeout, "server-timeout", 0, "abandon the remaining files of a server once it has been copying for this long (0 = no limit)")
+	flag.DurationVar(&progressEvery, "progress-interval", 0, "log the progress of the copy of a file this often, such as 10s, off when 0 (default: the progress_interval key, or 0)")
+	flag.BoolVar(&deterministic, "deterministic", false, "gather one server and one file at a time in sorted order, giving the same output and log on every run of the same sources, for tests; this disables all parallelism")
+	flag.BoolVar(&traceIO, "trace-io", false, "log the duration of the open, read, write, close and chtimes phases of every copied file at debug level, shown with -verbose")
+	flag.StringVar(&verifyDir, "verify-archives", "", "check the integrity of every compressed file in the given log `folder` instead of gathering")
+	flag.StringVar(&verifyCopy, "verify", "", "check the copies in the given window `folder` against the SHA-256 checksums in its manifest instead of gathering")
+	flag.BoolVar(&requireVer, "require-verify", false, "check every copy against the SHA-256 checksum in the manifest of its window folder once gathered, and exit with code 10 when any is missing or does not match, listing them in the summary; with -verify, exit with code 10 instead of 1")
+	flag.BoolVar(&repair, "repair", false, "remove corrupt archives found by -verify-archives")
+	flag.BoolVar(&purge, "archive-and-purge", false, "delete each source file once its copy is verified by checksum")
+	flag.DurationVar(&purgeMinAge, "purge-min-age", 24*time.Hour, "never delete source files modified less than this long ago with -archive-and-purge")
+	flag.StringVar(&profile, "profile", os.Getenv("LOGGATHERER_PROFILE"), "apply the [section.profile] overlays of this profile to the configuration (default: $LOGGATHERER_PROFILE)")
+	flag.StringVar(&logFile, "logfile", "", "also write the log to `file`, in addition to stderr (default: the logfile key, or only the .log file next to the executable)")
+	flag.BoolVar(&verbose, "verbose", false, "also log the debug messages about every file that is checked and copied")
+	flag.BoolVar(&quiet, "quiet", false, "only log errors and the summary")
+	flag.StringVar(&logFormat, "log-format", "text", "format of the log file (text or json)")
 	flag.BoolVar(&showver, "version", false, "show version information")
+	flag.BoolVar(&listConfig, "list", false, "list the configured clusters with their log share and servers instead of gathering")
 	flag.Parse()
 
 	if showver {
 		ShowVersion()
 	}
 
-	logF, err := os.OpenFile(fmt.Sprintf("%s.log", ep), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0777)
+	if err := setLogFormat(logFormat); err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	switch {
+	case verbose && quiet:
+		fatalf("[fatal] -verbose cannot be combined with -quiet")
+	case verbose:
+		logLevel = levelDebug
+	case quiet:
+		logLevel = levelError
+	}
+	if traceIO && !verbose {
+		logf("[warning] -trace-io logs its timings at debug level, add -verbose to see them")
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if err := loadConfig(configFile); err != nil {
+		fatalf("[fatal] cannot open ini file: %v", err)
+	}
+	if len(profile) > 0 {
+		if err := applyProfile(profile); err != nil {
+			fatalf("[fatal] cannot apply profile: %v", err)
+		}
+	}
+	if listConfig {
+		listClusters(os.Stdout)
+		os.Exit(0)
+	}
+	// flags which were not given explicitly take their default from the configuration
+	if !set["duration"] {
+		dur = cfg.Section("default").Key("duration").MustDuration(defaultDuration)
+	}
+	if !set["cluster"] {
+		cluster = cfg.Section("default").Key("cluster").Value()
+	}
+	if !set["parallel"] {
+		parallel = cfg.Section("default").Key("max_parallel").MustInt(runtime.NumCPU())
+	}
+	if !set["files-parallel"] {
+		filesParallel = cfg.Section("default").Key("files_parallel").MustInt(1)
+	}
+	if !set["compress-level"] {
+		levelName = cfg.Section("default").Key("compress_level").Value()
+	}
+	if !set["compress-min-size"] {
+		compressMinArg = cfg.Section("default").Key("compress_min_size").Value()
+	}
+	if !set["min-size"] {
+		minSizeArg = cfg.Section("default").Key("min_size").Value()
+	}
+	if !set["max-size"] {
+		maxSizeArg = cfg.Section("default").Key("max_size").Value()
+	}
+	if !set["skip-empty"] {
+		filter.SkipEmpty = cfg.Section("default").Key("skip_empty").MustBool(false)
+	}
+	if !set["timeout"] {
+		runTimeout = cfg.Section("default").Key("timeout").MustDuration(0)
+	}
+	if !set["logfile"] {
+		logFile = cfg.Section("default").Key("logfile").Value()
+	}
+	if !set["keep"] {
+		keepLast = cfg.Section("default").Key("keep_last").MustInt(0)
+	}
+	if !set["lock-max-age"] {
+		lockMaxAge = cfg.Section("default").Key("lock_max_age").MustDuration(24 * time.Hour)
+	}
+	if !set["dir-mode"] {
+		dirModeArg = cfg.Section("default").Key("dir_mode").Value()
+	}
+	if !set["file-mode"] {
+		fileModeArg = cfg.Section("default").Key("file_mode").Value()
+	}
+	if !set["max-total-size"] {
+		maxTotalArg = cfg.Section("default").Key("max_total_size").Value()
+	}
+	if !set["rate-limit"] {
+		rateArg = cfg.Section("default").Key("rate_limit").Value()
+	}
+	if !set["notify-url"] {
+		notifyURL = cfg.Section("default").Key("notify_url").Value()
+	}
+	if !set["metrics-file"] {
+		metricsFile = cfg.Section("default").Key("metrics_file").Value()
+	}
+	if !set["report-json"] {
+		reportJSON = cfg.Section("default").Key("report_json").Value()
+	}
+	if !set["notify-on"] {
+		notifyOn = cfg.Section("default").Key("notify_on").MustString("always")
+	}
+	if !set["notify-template"] {
+		notifyTmplArg = cfg.Section("default").Key("notify_template").MustString("generic-json")
+	}
+	if !set["notify-headers"] {
+		notifyHdrArg = cfg.Section("default").Key("notify_headers").Value()
+	}
+	if !set["skip-mode"] {
+		skipMode = cfg.Section("default").Key("skip_mode").MustString("mtime")
+	}
+	if !set["on-exists"] {
+		onExists = cfg.Section("default").Key("on_exists").MustString("overwrite")
+	}
+	if !set["progress-interval"] {
+		progressEvery = cfg.Section("default").Key("progress_interval").MustDuration(0)
+	}
+	if !set["preserve-owner"] {
+		preserveOwner = cfg.Section("default").Key("preserve_owner").MustBool(false)
+	}
+	if !set["dedup"] {
+		dedup = cfg.Section("default").Key("dedup").MustBool(false)
+	}
+	if !set["follow-symlinks"] {
+		followLinks = cfg.Section("default").Key("follow_symlinks").MustBool(false)
+	}
+	if !set["recursive"] {
+		recursive = cfg.Section("default").Key("recursive").MustBool(false)
+	}
+	// the verification modes only read the given folder
+	if len(verifyDir) == 0 && len(verifyCopy) == 0 {
+		if errs := validateConfig(cfg); len(errs) > 0 {
+			for _, err := range errs {
+				logf("[error] %v", err)
+			}
+			fatalf("[fatal] found %d problem(s) in the configuration", len(errs))
+		}
+	}
+	if listFormat != "csv" && listFormat != "json" {
+		fatalf("[fatal] invalid -list-format %q, expected csv or json", listFormat)
+	}
+	if parallel < 1 {
+		fatalf("[fatal] invalid -parallel %d, must be at least 1", parallel)
+	}
+	if progressEvery < 0 {
+		fatalf("[fatal] invalid -progress-interval %s, must not be negative", progressEvery)
+	}
+	if newest < 0 {
+		fatalf("[fatal] invalid -newest %d, must be at least 0", newest)
+	}
+	if newest > 0 && (len(fileList) > 0 || retryFailed) {
+		fatalf("[fatal] -newest cannot be combined with -files or -retry-failed")
+	}
+	if filesParallel < 1 {
+		fatalf("[fatal] invalid -files-parallel %d, must be at least 1", filesParallel)
+	}
+	if folderFmt, err = gatherer.ParseFolderFormat(cfg.Section("default").Key("folder_format").MustString(gatherer.DefaultFolderFormat)); err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	if keepLast < 0 {
+		fatalf("[fatal] invalid -keep %d, must be at least 0", keepLast)
+	}
+	retries := cfg.Section("default").Key("retries").MustInt(2)
+	retryDelay := cfg.Section("default").Key("retry_delay").MustDuration(time.Second)
+	if retries < 0 || retryDelay <= 0 {
+		fatalf("[fatal] invalid retries %d or retry_delay %s, retries must not be negative and retry_delay must be positive", retries, retryDelay)
+	}
+	retryOn, err := gatherer.ParseErrorPatterns(cfg.Section("default").Key("retry_on").Value())
 	if err != nil {
-		log.Fatalf("[fatal] cannot open log file: %v", err)
+		fatalf("[fatal] retry_on: %v", err)
+	}
+	noRetryOn, err := gatherer.ParseErrorPatterns(cfg.Section("default").Key("no_retry_on").Value())
+	if err != nil {
+		fatalf("[fatal] no_retry_on: %v", err)
+	}
+	archived := outputFormat == "zip" || outputFormat == "tar.gz"
+	switch {
+	case compress && outputFormat != "none" && outputFormat != "gzip":
+		fatalf("[fatal] -compress cannot be combined with -format %s", outputFormat)
+	case compress:
+		outputFormat = "gzip"
+	case outputFormat != "none" && outputFormat != "gzip" && outputFormat != "zstd" && !archived:
+		fatalf("[fatal] invalid -format %q, expected none, gzip, zstd, zip or tar.gz", outputFormat)
+	}
+	if archived && purge {
+		fatalf("[fatal] -archive-and-purge cannot be combined with -format %s", outputFormat)
+	}
+	if archived && dedup {
+		fatalf("[fatal] -dedup cannot be combined with -format %s", outputFormat)
+	}
+	if compressLevel, err = gatherer.ParseCompressLevel(levelName); err != nil {
+		fatalf("[fatal] invalid -compress-level: %v", err)
+	}
+	if dirMode, err = gatherer.ParseMode(dirModeArg, 0755); err != nil {
+		fatalf("[fatal] invalid -dir-mode: %v", err)
+	}
+	if fileMode, err = gatherer.ParseMode(fileModeArg, 0644); err != nil {
+		fatalf("[fatal] invalid -file-mode: %v", err)
+	}
+	if compressMin, err = gatherer.ParseSize(compressMinArg); err != nil {
+		fatalf("[fatal] invalid -compress-min-size: %v", err)
+	}
+	if compressMin > 0 && outputFormat == "tar.gz" {
+		logf("[warning] -compress-min-size has no effect with -format tar.gz, which compresses the archive as a whole")
+	}
+	if filter.MinSize, err = gatherer.ParseSize(minSizeArg); err != nil {
+		fatalf("[fatal] invalid -min-size: %v", err)
+	}
+	if filter.MaxSize, err = gatherer.ParseSize(maxSizeArg); err != nil {
+		fatalf("[fatal] invalid -max-size: %v", err)
+	}
+	if maxTotal, err = gatherer.ParseSize(maxTotalArg); err != nil {
+		fatalf("[fatal] invalid -max-total-size: %v", err)
+	}
+	rate, err := gatherer.ParseRate(rateArg)
+	if err != nil {
+		fatalf("[fatal] invalid -rate-limit: %v", err)
+	}
+	if filter.MaxSize > 0 && filter.MaxSize < filter.MinSize {
+		fatalf("[fatal] -max-size %d is smaller than -min-size %d", filter.MaxSize, filter.MinSize)
+	}
+	if manifestFmt != "none" && manifestFmt != "csv" && manifestFmt != "json" {
+		fatalf("[fatal] invalid -manifest %q, expected none, csv or json", manifestFmt)
+	}
+	if len(combine) > 0 && combine != "ndjson" {
+		fatalf("[fatal] invalid -combine %q, expected ndjson", combine)
+	}
+	if filter.TimeField != "mtime" && filter.TimeField != "ctime" && filter.TimeField != "overlap" {
+		fatalf("[fatal] invalid -time-field %q, expected mtime, ctime or overlap", filter.TimeField)
+	}
+	if notifyOn != "always" && notifyOn != "failure" {
+		fatalf("[fatal] invalid -notify-on %q, expected always or failure", notifyOn)
+	}
+	// a body which cannot be used leaves the default one for the notification of the error
+	tmpl, err := parseNotifyTemplate(notifyTmplArg)
+	if err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	headers, err := parseNotifyHeaders(notifyHdrArg)
+	if err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	notifyTmpl, notifyHeaders = tmpl, headers
+	if skipMode != "mtime" && skipMode != "hash" {
+		fatalf("[fatal] invalid -skip-mode %q, expected mtime or hash", skipMode)
+	}
+	if skipExisting && skipMode == "hash" && manifestFmt == "none" {
+		fatalf("[fatal] -skip-mode hash needs -manifest csv or json to record the digests of the copies")
+	}
+	if onExists != "overwrite" && onExists != "skip" && onExists != "rename" {
+		fatalf("[fatal] invalid -on-exists %q, expected overwrite, skip or rename", onExists)
+	}
+	if preserveOwner && !gatherer.CanChown() {
+		logf("[warning] ignoring -preserve-owner, which needs root on Unix")
+		preserveOwner = false
+	}
+	if mtimeFrom != "source-mtime" && mtimeFrom != "source-ctime" && mtimeFrom != "now" {
+		fatalf("[fatal] invalid -output-mtime-from %q, expected source-mtime, source-ctime or now", mtimeFrom)
+	}
+
+	// without -logfile the log only goes to the .log file next to the executable
+	logName := fmt.Sprintf("%s.log", ep)
+	if len(logFile) > 0 {
+		logName = logFile
+	}
+	logF, err := os.OpenFile(logName, os.O_APPEND|os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		fatalf("[fatal] cannot open log file: %v", err)
+	}
+	exit := func(code int) {
+		releaseLocks()
+		logF.Close()
+		os.Exit(code)
 	}
 	defer logF.Close()
 
-	log.SetOutput(logF)
+	if len(logFile) > 0 {
+		log.SetOutput(io.MultiWriter(os.Stderr, logF))
+	} else {
+		log.SetOutput(logF)
+	}
 
 	if clean {
-		log.Printf("starting clean-up of logs")
-		cleanup()
-		log.Print("finished")
-		os.Exit(0)
+		logf("starting clean-up of logs")
+		var reclaimed int64
+		var left []gatherer.Folder
+		for _, c := range clusterNames(cluster) {
+			r, l := cleanup(c, cfg.Section(c).Key("retention").MustDuration(dur))
+			reclaimed += r
+			left = append(left, l...)
+		}
+		if maxTotal > 0 {
+			reclaimed += trimFolders(left)
+		}
+		logf("[info] reclaimed %d bytes in total", reclaimed)
+		logf("finished")
+		exit(0)
 	}
-	if len(start) == 0 {
-		startTime = time.Now().UTC().Add(-1 * dur)
-	} else {
-		startTime, err = time.ParseInLocation("2006-01-02 15:04:05", start, time.UTC)
+	if len(verifyDir) > 0 {
+		logf("starting verification of archives")
+		if corrupt := verifyArchives(verifyDir, repair); corrupt > 0 && !repair {
+			fatalf("[fatal] %d corrupt archive(s) found in %q", corrupt, verifyDir)
+		}
+		logf("finished")
+		exit(0)
+	}
+	if len(verifyCopy) > 0 {
+		logf("starting verification of copies")
+		bad, err := verifyManifest(verifyCopy)
 		if err != nil {
-			log.Fatalf("[fatal] cannot parse start date: %v", err)
+			fatalf("[fatal] %v", err)
+		}
+		if len(bad) > 0 && requireVer {
+			logUnverified(bad)
+			exit(exitUnverified)
 		}
+		if len(bad) > 0 {
+			fatalf("[fatal] %d copies in %q do not match their manifest", len(bad), verifyCopy)
+		}
+		logf("finished")
+		exit(0)
 	}
-	endTime = startTime.Add(dur)
-
-	var destination string
-	if filepath.IsAbs(cfg.Section("default").Key("destination").Value()) {
-		destination = cfg.Section("default").Key("destination").Value()
+	switch {
+	case requireVer && manifestFmt == "none":
+		fatalf("[fatal] -require-verify needs -manifest csv or json to verify the copies against")
+	case requireVer && (dryRun || listOnly || len(output) > 0):
+		fatalf("[fatal] -require-verify cannot be combined with -dry-run, -list-only or -output")
+	}
+	startLoc := time.UTC
+	switch {
+	case localStart && len(tzName) > 0:
+		fatalf("[fatal] -local cannot be combined with -tz")
+	case localStart:
+		startLoc = time.Local
+	case len(tzName) > 0:
+		if startLoc, err = time.LoadLocation(tzName); err != nil {
+			fatalf("[fatal] invalid -tz: %v", err)
+		}
+	}
+	switch {
+	case sinceLast && len(end) > 0:
+		fatalf("[fatal] -since-last cannot be combined with -end")
+	case sinceLast && len(start) > 0:
+		fatalf("[fatal] -since-last cannot be combined with -start")
+	case sinceLast && len(incident) > 0:
+		fatalf("[fatal] -since-last cannot be combined with -incident")
+	}
+	if len(incident) > 0 {
+		if len(start) > 0 {
+			fatalf("[fatal] -incident cannot be combined with -start")
+		}
+		var idur time.Duration
+		if start, idur, err = lookupIncident(incident); err != nil {
+			fatalf("[fatal] %v", err)
+		}
+		if idur > 0 && !set["duration"] {
+			dur = idur
+		}
+		logf("[info] using incident %q starting at %s", incident, start)
+		// incidents are recorded in UTC
+		startLoc = time.UTC
+	}
+	if startTime, endTime, err = period(start, end, dur, set["duration"], time.Now(), startLoc); err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	dur = endTime.Sub(startTime)
+	// without a period given, -newest considers the files of any time
+	filter.AnyTime = newest > 0 && len(start) == 0 && len(end) == 0 && !set["duration"] && !sinceLast
+	if sinceLast {
+		// startTime is where the clusters without a previous gather start
+		endTime = time.Now().UTC()
+		startTime = endTime.Add(-1 * dur)
+		logf("[info] gathering the period since the previous gather up to %s UTC", endTime.Format("2006-01-02 15:04:05"))
+	} else if filter.AnyTime {
+		logf("[info] gathering the newest %d file(s) of each server, regardless of their time", newest)
 	} else {
-		destination = fmt.Sprintf("%s/%s", strings.ReplaceAll(wd, "\\", "/"), cfg.Section("default").Key("destination").Value())
+		logf("[info] gathering the period from %s to %s UTC", startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
 	}
-	destination += fmt.Sprintf("/%s/%s-%s", cluster, startTime.Format("20060102T150405Z"), endTime.Format("20060102T150405Z"))
 
-	sect := cfg.Section(cluster)
-	var (
-		share string
-		wg    sync.WaitGroup
-	)
-	for _, k := range sect.Keys() {
-		if k.Name() == "logshare" {
-			share = k.MustString("SPSS_DIMENSIONS_LOGS")
-			continue
+	destination := gatherer.Destination(cfg.Section("default").Key("destination").Value(), wd)
+	// a dry run and -output - write nothing into the destination
+	if !dryRun && len(output) == 0 {
+		if err := checkDestination(destination); err != nil {
+			fatalf("[fatal] cannot gather into destination %q: %v", destination, err)
 		}
-		wg.Add(1)
-		go CopyFiles(k.Name(), fmt.Sprintf("//%s/%s", k.Value(), share), destination, &wg)
 	}
-	wg.Wait()
-}
-
-func CopyFiles(server, src, dst string, w *sync.WaitGroup) {
-	defer w.Done()
-	log.Printf("[info] scanning %s", src)
 
-	_, err := os.Stat(fmt.Sprintf("%s/%s", dst, server))
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			if err := os.MkdirAll(fmt.Sprintf("%s/%s", dst, server), 0777); err != nil {
-				log.Fatalf("[fatal] error creating destination folder: %v", err)
+	var clusters []*gatherer.Cluster
+	if overlays := overlaySections(); len(overlays) > 0 && strings.EqualFold(strings.TrimSpace(cluster), "all") {
+		logf("[info] -cluster all leaves out the profile overlay sections %s", strings.Join(overlays, ", "))
+	}
+	for _, c := range clusterNames(cluster) {
+		clusters = append(clusters, loadCluster(c, destination, set))
+	}
+	runClusters = clusters
+	if len(clusters) == 0 {
+		fatalf("[fatal] no cluster specified")
+	}
+	if sinceLast {
+		// the hooks, notification and metrics report the start of the earliest cluster
+		for _, cl := range clusters {
+			if cl.Filter.Start.Before(startTime) {
+				startTime = cl.Filter.Start
 			}
-		} else {
-			log.Fatalf("[fatal] error opening destination folder: %v (%v)", err, errors.Is(err.(*os.PathError).Err, os.ErrNotExist))
 		}
 	}
 
-	sdir, err := os.ReadDir(src)
-	if err != nil {
-		log.Printf("[error][%s] unable to open %q: %v", server, src, err)
-		return
-	}
-
-	for _, f := range sdir {
-		if !f.IsDir() {
-			if finfo, err := f.Info(); err != nil {
-				log.Printf("[error][%s] cannot read file info for %q: %v", server, f.Name(), err)
-				continue
-			} else {
-				targetName := finfo.Name()
-				if compress {
-					targetName += ".gz"
-				}
-				// log.Printf("[debug][%s] checking %s (m=%s | c=%s)...", server, finfo.Name(), finfo.ModTime().Format("2006-01-02 15:04:05"), time.Unix(0, finfo.Sys().(*syscall.Win32FileAttributeData).CreationTime.Nanoseconds()).Format("2006-01-02 15:04:05"))
-
-				fMod := finfo.ModTime()
-				fCreate := time.Unix(0, finfo.Sys().(*syscall.Win32FileAttributeData).CreationTime.Nanoseconds())
-				if fMod.After(startTime) && fCreate.Before(endTime) && strings.HasSuffix(finfo.Name(), ".tmp") {
-					// log.Printf("[debug][%s] file %s is between %q and %q", server, finfo.Name(), startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
-					s, err := os.Open(fmt.Sprintf("%s/%s", src, f.Name()))
-					if err != nil {
-						log.Printf("[error][%s] cannot open source file %q: %v", server, f.Name(), err)
-						continue
-					}
-					var (
-						d  io.WriteCloser
-						zd io.WriteCloser
-					)
-					if compress {
-						zd, err = os.Create(fmt.Sprintf("%s/%s/%s", dst, server, targetName))
-						d = gzip.NewWriter(zd)
-						if err != nil {
-							log.Printf("[error][%s] cannot open destination file %q: %v", server, targetName, err)
-							s.Close()
-							continue
-						}
-					} else {
-						d, err = os.Create(fmt.Sprintf("%s/%s/%s", dst, server, targetName))
-						if err != nil {
-							log.Printf("[error][%s] cannot open destination file %q: %v", server, targetName, err)
-							s.Close()
-							continue
-						}
-					}
-					if err := copyFile(s, d); err != nil {
-						log.Printf("[error][%s] cannot copy source to destination %q: %v", server, targetName, err)
-						s.Close()
-						d.Close()
-						if compress {
-							zd.Close()
-						}
-						continue
-					}
-					s.Close()
-					d.Close()
-					if compress {
-						zd.Close()
-					}
-					// log.Printf("[debug][%s] setting last modified date on %s to %s...", server, finfo.Name(), fMod.Format("2006-01-02 15:04:05"))
-					if err := os.Chtimes(fmt.Sprintf("%s/%s/%s", dst, server, targetName), time.Now(), fMod); err != nil {
-						log.Printf("[error][%s] error setting last modified date on %s: %v", server, targetName, err)
-					}
+	if len(serverName) > 0 {
+		found := false
+		for _, cl := range clusters {
+			var servers []*gatherer.Server
+			for _, srv := range cl.Servers {
+				if srv.Name == serverName {
+					servers = append(servers, srv)
+					found = true
 				}
 			}
+			cl.Servers = servers
+		}
+		if !found {
+			fatalf("[fatal] -server %q is not a server of cluster %s", serverName, cluster)
+		}
+	}
+	switch {
+	case len(output) == 0:
+	case output != "-":
+		fatalf("[fatal] invalid -output %q, expected - for stdout", output)
+	case len(clusters) > 1:
+		fatalf("[fatal] -output - can only be used with a single cluster")
+	case len(serverName) == 0:
+		fatalf("[fatal] -output - needs -server")
+	case len(fileList) > 0 || retryFailed || dryRun || listOnly:
+		fatalf("[fatal] -output - cannot be combined with -files, -retry-failed, -dry-run or -list-only")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if runTimeout > 0 {
+		ctx, cancel = context.WithDeadline(ctx, began.Add(runTimeout))
+		defer cancel()
+	}
+	// the signals are handled before the clusters are locked, so an interrupt while waiting for a
+	// lock or running the pre_hook still removes the locks taken
+	handlePauseSignals()
+	handleInterrupt(cancel)
+	conf := gatherer.Config{
+		Clusters:      clusters,
+		Decompress:    decompress,
+		Format:        outputFormat,
+		CompressLevel: compressLevel,
+		CompressMin:   compressMin,
+		Recompress:    recompress,
+		Combine:       len(combine) > 0,
+		CombineMax:    combineMax,
+		DryRun:        dryRun,
+		ListOnly:      listOnly,
+		ListFormat:    listFormat,
+		Manifest:      manifestFmt,
+		Newest:        newest,
+		Recursive:     recursive,
+		FollowLinks:   followLinks,
+		MtimeFrom:     mtimeFrom,
+		NoClobber:     noClobber,
+		SkipExisting:  skipExisting,
+		SkipMode:      skipMode,
+		OnExists:      onExists,
+		Purge:         purge,
+		PurgeMinAge:   purgeMinAge,
+		Dedup:         dedup,
+		PreserveOwner: preserveOwner,
+		DirMode:       dirMode,
+		FileMode:      fileMode,
+		Parallel:      parallel,
+		Retries:       retries,
+		RetryDelay:    retryDelay,
+		RetryOn:       retryOn,
+		NoRetryOn:     noRetryOn,
+		RateLimit:     rate,
+		FailFast:      failFast,
+		Timeout:       runTimeout,
+		ServerTimeout: serverTimeout,
+		Progress:      progressEvery,
+		TraceIO:       traceIO,
+		Deterministic: deterministic,
+		Pause:         gate.wait,
+		Logf:          logf,
+	}
+	if len(output) > 0 {
+		// streaming writes nothing to the destination, so there are no hooks or manifests
+		conf.Output = os.Stdout
+		stats, err := gatherer.Gather(ctx, conf)
+		if err != nil {
+			fatalf("[fatal] %v", err)
+		}
+		result := runOutcome(stats)
+		logSummary(result, stats, time.Since(began))
+		exit(result.exitCode(stats.DestinationFull))
+	}
+	var paths map[string][]string
+	if len(fileList) > 0 {
+		if len(clusters) > 1 {
+			fatalf("[fatal] -files can only be used with a single cluster")
+		}
+		if paths, err = readFileList(fileList, clusters[0]); err != nil {
+			fatalf("[fatal] cannot read file list: %v", err)
+		}
+	}
+	if retryFailed {
+		switch {
+		case len(fileList) > 0:
+			fatalf("[fatal] -retry-failed cannot be combined with -files")
+		case len(clusters) > 1:
+			fatalf("[fatal] -retry-failed can only be used with a single cluster")
+		}
+		name := fmt.Sprintf("%s/%s", clusters[0].Destination, gatherer.FailedList)
+		if paths, err = readFileList(name, clusters[0]); errors.Is(err, os.ErrNotExist) || (err == nil && len(paths) == 0) {
+			logf("[info] there are no failed files to retry in %q", fileName(clusters[0].Destination))
+			logSummary(outcomeSuccess, gatherer.Stats{}, time.Since(began))
+			exit(0)
+		} else if err != nil {
+			fatalf("[fatal] cannot read %q: %v", fileName(name), err)
+		}
+	}
+	if !dryRun {
+		if ok, full := lockClusters(ctx, destination, clusters); !ok {
+			if atomic.LoadInt32(&interrupted) == 1 {
+				reportRun(clusters, gatherer.Stats{}, outcomeInterrupted, exitInterrupted, time.Since(began))
+				exit(exitInterrupted)
+			}
+			if full {
+				reportRun(clusters, gatherer.Stats{}, outcomeAborted, exitDestinationFull, time.Since(began))
+				exit(exitDestinationFull)
+			}
+			reportRun(clusters, gatherer.Stats{}, outcomeAborted, exitLocked, time.Since(began))
+			exit(exitLocked)
+		}
+		defer releaseLocks()
+	}
+	// the hooks are not run for a dry run, as they usually act on the gathered files
+	var env []string
+	if !dryRun {
+		env = hookEnv(destination, clusters)
+		if !runHook(ctx, "pre_hook", env) && hookFatal {
+			logf("[fatal] the pre_hook failed, not gathering (-hook-fatal)")
+			reportRun(clusters, gatherer.Stats{}, outcomeAborted, exitHookFailed, time.Since(began))
+			exit(exitHookFailed)
 		}
 	}
-	log.Printf("[info] done scanning %s", server)
+	conf.Paths = paths
+	if !force && !dryRun && !listOnly && !checkFreeSpace(ctx, destination, conf) {
+		reportRun(clusters, gatherer.Stats{}, outcomeAborted, exitDestinationFull, time.Since(began))
+		exit(exitDestinationFull)
+	}
+	stats, err := gatherer.Gather(ctx, conf)
+	if err != nil {
+		fatalf("[fatal] %v", err)
+	}
+	if atomic.LoadInt32(&interrupted) == 1 {
+		logf("[error] the gather was interrupted, the copies of the remaining files are missing")
+	}
+
+	if len(stats.TimedOut) > 0 {
+		logf("[error] %d server(s) did not finish in time: %s", len(stats.TimedOut), strings.Join(stats.TimedOut, ", "))
+	}
+
+	if stats.DestinationFull {
+		logf("[fatal] destination %q is full or over quota, gathering was stopped", destination)
+		fmt.Fprintf(os.Stderr, "destination %q is full or over quota, gathering was stopped\n", destination)
+	}
+
+	result := runOutcome(stats)
+	var unverified []string
+	if requireVer {
+		unverified = verifyClusters(clusters)
+	}
+	// copies which cannot be verified fail a run which gathered everything it could
+	if len(unverified) > 0 && (result == outcomeSuccess || result == outcomePartial) {
+		result = outcomeUnverified
+	}
+	logSummary(result, stats, time.Since(began))
+	if len(unverified) > 0 {
+		logUnverified(unverified)
+	}
+	code := result.exitCode(stats.DestinationFull)
+	if !dryRun && !runHook(context.Background(), "post_hook", append(env, summaryEnv(result, stats)...)) && hookFatal && code == 0 {
+		logf("[fatal] the post_hook failed (-hook-fatal)")
+		code = exitHookFailed
+	}
+	if !dryRun {
+		reportRun(clusters, stats, result, code, time.Since(began))
+	}
+	if code != 0 {
+		exit(code)
+	}
+}
+
+// checkDestination makes sure the destination root can be written to before anything is
+// gathered: the folder itself when it exists, otherwise its parent, which it is created in.
+func checkDestination(destination string) error {
+	dir := destination
+	if _, err := os.Stat(destination); errors.Is(err, os.ErrNotExist) {
+		// path.Dir would turn the //server/share of a UNC destination into /server
+		dir = filepath.Dir(filepath.FromSlash(destination))
+	}
+	finfo, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !finfo.IsDir() {
+		return fmt.Errorf("%q is not a folder", dir)
+	}
+	f, err := os.CreateTemp(dir, ".loggatherer-*")
+	if err != nil {
+		return fmt.Errorf("%q is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
 }
 
-func copyFile(source io.Reader, dest io.Writer) error {
-	buf := make([]byte, 1024)
-	for {
-		n, err := source.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
+// period returns the UTC start and end of the period to gather from -start, -end and -duration
+// dur, which durSet tells whether it was given explicitly. Without -start the period ends at
+// -end, or now without it either; without -end it lasts dur. Both -start and -end only take an
+// explicit -duration when it agrees with them.
+func period(start, end string, dur time.Duration, durSet bool, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	startTime := now.UTC().Add(-1 * dur)
+	if len(start) > 0 {
+		t, err := gatherer.ParseStart(start, now, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
 		}
-		if n == 0 {
-			break
+		startTime = t.UTC()
+	}
+	if len(end) == 0 {
+		return startTime, startTime.Add(dur), nil
+	}
+	endTime, err := gatherer.ParseEnd(end, now, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endTime = endTime.UTC()
+	switch {
+	case len(start) == 0:
+		// the period of -duration up to -end
+		return endTime.Add(-1 * dur), endTime, nil
+	case !endTime.After(startTime):
+		return time.Time{}, time.Time{}, fmt.Errorf("-end %s is not after -start %s", endTime.Format("2006-01-02 15:04:05"), startTime.Format("2006-01-02 15:04:05"))
+	case durSet && endTime.Sub(startTime) != dur:
+		return time.Time{}, time.Time{}, fmt.Errorf("-duration %s disagrees with -start and -end, which are %s apart", dur, endTime.Sub(startTime))
+	}
+	return startTime, endTime, nil
+}
+
+// reportRun sends the -notify-url notification and writes the -metrics-file and -report-json of
+// the gather of clusters with the statistics stats, which ended with result and exit code after
+// elapsed.
+func reportRun(clusters []*gatherer.Cluster, stats gatherer.Stats, result outcome, code int, elapsed time.Duration) {
+	notify(clusters, stats, result, code, elapsed)
+	if len(metricsFile) > 0 {
+		if err := writeMetrics(metricsFile, stats, code, elapsed); err != nil {
+			logf("[error] cannot write metrics file %q: %v", fileName(metricsFile), err)
 		}
+	}
+	if len(reportJSON) > 0 {
+		if err := writeReport(reportJSON, clusters, stats, result, code, elapsed); err != nil {
+			logf("[error] cannot write report %q: %v", fileName(reportJSON), err)
+		}
+	}
+}
 
-		if _, err := dest.Write(buf[:n]); err != nil {
-			return err
+// readFileList reads the file with "server:path" lines and returns the listed paths per server of
+// cluster cl. Empty lines and lines starting with '#' are ignored.
+func readFileList(name string, cl *gatherer.Cluster) (map[string][]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, srv := range cl.Servers {
+		known[srv.Name] = true
+	}
+	paths := make(map[string][]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		srv, p, ok := strings.Cut(line, ":")
+		srv, p = strings.TrimSpace(srv), strings.TrimSpace(p)
+		if !ok || len(p) == 0 {
+			return nil, fmt.Errorf("line %d: expected server:path, got %q", i+1, line)
 		}
+		if !known[srv] {
+			return nil, fmt.Errorf("line %d: unknown server %q in cluster %q", i+1, srv, cl.Name)
+		}
+		// the path is kept below the server folder, so it must not leave the log share
+		p = filepath.ToSlash(filepath.Clean(strings.ReplaceAll(p, "\\", "/")))
+		if p == ".." || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "/") || filepath.IsAbs(p) {
+			return nil, fmt.Errorf("line %d: path %q is not relative to the log share", i+1, p)
+		}
+		paths[srv] = append(paths[srv], p)
 	}
-	return nil
+	return paths, nil
 }
 
-func cleanup() {
-	var destination string
+// cleanup removes the log folders of cluster whose period ended more than retention ago, apart
+// from the -keep most recent ones. It returns the number of bytes reclaimed and the folders left.
+func cleanup(cluster string, retention time.Duration) (int64, []gatherer.Folder) {
 	wd, _ := execpath.GetDir()
+	destination := fmt.Sprintf("%s/%s", gatherer.Destination(cfg.Section("default").Key("destination").Value(), wd), cluster)
 
-	if filepath.IsAbs(cfg.Section("default").Key("destination").Value()) {
-		destination = cfg.Section("default").Key("destination").Value()
-	} else {
-		destination = fmt.Sprintf("%s/%s", strings.ReplaceAll(wd, "\\", "/"), cfg.Section("default").Key("destination").Value())
+	folders, err := gatherer.PeriodFolders(destination, folderFmt, cluster, keepLast)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logf("[info] nothing to clean up for cluster %q", cluster)
+			return 0, nil
+		}
+		fatalf("[fatal] cannot read from folder %q: %v", destination, err)
 	}
-	destination += fmt.Sprintf("/%s", cluster)
 
-	entries, err := os.ReadDir(destination)
-	if err != nil {
-		log.Fatalf("[fatal] cannot read from folder %q: %v", destination, err)
+	removed := removeFolders(gatherer.Expired(folders, retention, time.Now().UTC()))
+	var reclaimed int64
+	var left []gatherer.Folder
+	for _, f := range folders {
+		if removed[f.Path] {
+			reclaimed += f.Size
+		} else {
+			left = append(left, f)
+		}
 	}
+	logf("[info] reclaimed %d bytes for cluster %q", reclaimed, cluster)
+	return reclaimed, left
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			dtParts := strings.Split(entry.Name(), "-")
-			if len(entry.Name()) == 33 && len(dtParts) == 2 {
-				endT, err := time.Parse("20060102T150405Z", dtParts[1])
-				if err != nil {
-					continue
-				}
+// trimFolders removes the oldest of folders until their total size is at most -max-total-size
+// and returns the number of bytes reclaimed.
+func trimFolders(folders []gatherer.Folder) int64 {
+	remove, total := gatherer.OverBudget(folders, maxTotal)
+	removed := removeFolders(remove)
+	var reclaimed int64
+	for _, f := range remove {
+		if removed[f.Path] {
+			reclaimed += f.Size
+		} else {
+			total += f.Size
+		}
+	}
+	logf("[info] reclaimed %d bytes to stay within -max-total-size %d, %d bytes left", reclaimed, maxTotal, total)
+	if total > maxTotal {
+		logf("[warning] the log folders still use %d bytes, more than -max-total-size %d", total, maxTotal)
+	}
+	return reclaimed
+}
 
-				if endT.Before(time.Now().UTC().Add(-1 * dur)) {
-					log.Printf("[info] cleaning up %s...", fmt.Sprintf("%s/%s", destination, entry.Name()))
-					if err := os.RemoveAll(fmt.Sprintf("%s/%s", destination, entry.Name())); err != nil {
-						log.Printf("[error] cannot delete folder %q: %v", fmt.Sprintf("%s/%s", destination, entry.Name()), err)
-					}
-				}
+// removeFolders removes folders, or only logs them with -dry-run, and returns the ones removed.
+func removeFolders(folders []gatherer.Folder) map[string]bool {
+	removed := make(map[string]bool)
+	for _, f := range folders {
+		if dryRun {
+			logf("[info] would clean up %s (%d bytes)", fileName(f.Path), f.Size)
+			removed[f.Path] = true
+			continue
+		}
+		logf("[info] cleaning up %s...", fileName(f.Path))
+		if err := os.RemoveAll(f.Path); err != nil {
+			logf("[error] cannot delete folder %q: %v", fileName(f.Path), err)
+			continue
+		}
+		removed[f.Path] = true
+	}
+	return removed
+}
+
+// clusterNames returns the clusters selected by spec, which is either a comma-separated list
+// of cluster names or "all" for every cluster section in the ini file.
+func clusterNames(spec string) []string {
+	var names []string
+	if strings.EqualFold(strings.TrimSpace(spec), "all") {
+		for _, sect := range cfg.Sections() {
+			if _, _, isProfile := profileOverlay(sect.Name()); !isProfile && sect.Name() != ini.DefaultSection && sect.Name() != "default" {
+				names = append(names, sect.Name())
 			}
 		}
+		return names
+	}
+	for _, c := range strings.Split(spec, ",") {
+		if c = strings.TrimSpace(c); len(c) > 0 {
+			names = append(names, c)
+		}
 	}
+	return names
 }
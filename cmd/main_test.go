@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+func TestCheckDestination(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{filepath.ToSlash(dir)}
+	if runtime.GOOS == "windows" {
+		// the same folder through the administrative share of its drive, as a UNC destination
+		unc := "//localhost/" + strings.Replace(filepath.ToSlash(dir), ":", "$", 1)
+		if _, err := os.Stat(unc); err == nil {
+			roots = append(roots, unc)
+		} else {
+			t.Logf("skipping the UNC destinations: %v", err)
+		}
+	}
+	tests := []struct {
+		dest string
+		ok   bool
+	}{
+		{"", true},
+		{"/logs", true},
+		{"/missing/logs", false},
+		{"/file", false},
+		{"/file/logs", false},
+	}
+	for _, root := range roots {
+		for _, tt := range tests {
+			err := checkDestination(root + tt.dest)
+			if (err == nil) != tt.ok {
+				t.Errorf("checkDestination(%q) = %v, want ok %t", root+tt.dest, err, tt.ok)
+			}
+		}
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	cl := &gatherer.Cluster{Name: "web", Servers: []*gatherer.Server{{Name: "web01"}, {Name: "web02"}}}
+	tests := []struct {
+		name string
+		list string
+		want map[string][]string // nil when the list is rejected
+	}{
+		{"paths", "web01:a.tmp\nweb02: sub/b.tmp \nweb01:c.tmp\n", map[string][]string{"web01": {"a.tmp", "c.tmp"}, "web02": {"sub/b.tmp"}}},
+		{"comments and empty lines", "# files\n\nweb01:a.tmp\n", map[string][]string{"web01": {"a.tmp"}}},
+		{"backslashes", `web01:sub\b.tmp`, map[string][]string{"web01": {"sub/b.tmp"}}},
+		{"cleaned", "web01:sub/../a.tmp\nweb01:./b.tmp", map[string][]string{"web01": {"a.tmp", "b.tmp"}}},
+		{"empty", "# nothing\n", map[string][]string{}},
+		// the failed.txt read by -retry-failed, with the share folders of a cluster with several shares
+		{"failed list", "# files of cluster web which could not be read, copied again by -retry-failed\nweb01:iis/logs/a.tmp\nweb02:logs/b.tmp\n", map[string][]string{"web01": {"iis/logs/a.tmp"}, "web02": {"logs/b.tmp"}}},
+		{"parent", "web01:../a.tmp", nil},
+		{"parent after cleaning", "web01:sub/../../a.tmp", nil},
+		{"parent with backslashes", `web01:..\a.tmp`, nil},
+		{"only parent", "web01:..", nil},
+		{"absolute", "web01:/etc/passwd", nil},
+		{"absolute with backslashes", `web01:\etc\passwd`, nil},
+		{"unknown server", "web03:a.tmp", nil},
+		{"no path", "web01:", nil},
+		{"no server", "a.tmp", nil},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "files.txt")
+		if err := os.WriteFile(name, []byte(tt.list), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths, err := readFileList(name, cl)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: readFileList = %q, want an error", tt.name, paths)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(paths, tt.want) {
+			t.Errorf("%s: readFileList = %q, %v, want %q", tt.name, paths, err, tt.want)
+		}
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", "2024-03-01 "+clock)
+		return tm
+	}
+	cet := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name       string
+		start, end string
+		dur        time.Duration
+		durSet     bool
+		loc        *time.Location
+		from, to   time.Time // zero when period fails
+	}{
+		{"defaults", "", "", time.Hour, false, time.UTC, at("11:00"), now},
+		{"start", "2024-03-01 08:00:00", "", 2 * time.Hour, true, time.UTC, at("08:00"), at("10:00")},
+		{"start in another location", "2024-03-01 08:00:00", "", time.Hour, false, cet, at("07:00"), at("08:00")},
+		{"end", "", "2024-03-01 10:00:00", 30 * time.Minute, true, time.UTC, at("09:30"), at("10:00")},
+		{"relative end", "", "-1h", time.Hour, false, time.UTC, at("10:00"), at("11:00")},
+		{"start and end", "2024-03-01 08:00:00", "2024-03-01 10:30:00", time.Hour, false, time.UTC, at("08:00"), at("10:30")},
+		{"start, end and agreeing duration", "2024-03-01 08:00:00", "2024-03-01 10:30:00", 150 * time.Minute, true, time.UTC, at("08:00"), at("10:30")},
+		{"start, end and disagreeing duration", "2024-03-01 08:00:00", "2024-03-01 10:30:00", time.Hour, true, time.UTC, time.Time{}, time.Time{}},
+		{"end at start", "2024-03-01 08:00:00", "2024-03-01 08:00:00", time.Hour, false, time.UTC, time.Time{}, time.Time{}},
+		{"end before start", "2024-03-01 08:00:00", "2024-03-01 07:00:00", time.Hour, false, time.UTC, time.Time{}, time.Time{}},
+		{"invalid start", "08:00", "", time.Hour, false, time.UTC, time.Time{}, time.Time{}},
+		{"invalid end", "", "10:00", time.Hour, false, time.UTC, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		from, to, err := period(tt.start, tt.end, tt.dur, tt.durSet, now, tt.loc)
+		if tt.from.IsZero() {
+			if err == nil {
+				t.Errorf("%s: period = %s, %s, want an error", tt.name, from, to)
+			}
+			continue
+		}
+		if err != nil || !from.Equal(tt.from) || !to.Equal(tt.to) || from.Location() != time.UTC {
+			t.Errorf("%s: period = %s, %s, %v, want %s, %s", tt.name, from, to, err, tt.from, tt.to)
+		}
+	}
+}
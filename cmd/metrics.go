@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// serverMetrics are the per-server metrics written by -metrics-file, taken from the statistics
+// of the summary.
+var serverMetrics = []struct {
+	name, help string
+	value      func(s gatherer.ServerStats) int64
+}{
+	{"loggatherer_files_matched_total", "Files matching the filters.", func(s gatherer.ServerStats) int64 { return int64(s.Matched) }},
+	{"loggatherer_files_copied_total", "Files copied successfully.", func(s gatherer.ServerStats) int64 { return int64(s.Copied) }},
+	{"loggatherer_files_skipped_total", "Files skipped because their copy already exists.", func(s gatherer.ServerStats) int64 { return int64(s.Skipped) }},
+	{"loggatherer_files_changed_total", "Files which changed while they were copied.", func(s gatherer.ServerStats) int64 { return int64(s.Changed) }},
+	{"loggatherer_bytes_read_total", "Bytes read from the log shares.", func(s gatherer.ServerStats) int64 { return s.Read }},
+	{"loggatherer_bytes_written_total", "Bytes written to the destination.", func(s gatherer.ServerStats) int64 { return s.Written }},
+	{"loggatherer_errors_total", "Errors while gathering.", func(s gatherer.ServerStats) int64 { return int64(s.Errors) }},
+}
+
+// writeMetrics writes the statistics stats of the run, which ended with the exit code after
+// elapsed, to path in the text format of Prometheus, for the textfile collector of the
+// node_exporter. The file is replaced at once, so the collector never reads a partial one.
+func writeMetrics(path string, stats gatherer.Stats, code int, elapsed time.Duration) error {
+	tmp := path + ".tmp"
+	f, err := gatherer.CreateFile(tmp, fileMode)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, m := range serverMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+		for _, s := range stats.Servers {
+			fmt.Fprintf(w, "%s{cluster=\"%s\",server=\"%s\"} %d\n", m.name, labelValue(s.Cluster), labelValue(s.Server), m.value(s))
+		}
+	}
+	fmt.Fprintf(w, "# HELP loggatherer_duration_seconds Duration of the run.\n# TYPE loggatherer_duration_seconds gauge\nloggatherer_duration_seconds %g\n", elapsed.Seconds())
+	fmt.Fprintf(w, "# HELP loggatherer_exit_code Exit code of the run.\n# TYPE loggatherer_exit_code gauge\nloggatherer_exit_code %d\n", code)
+	fmt.Fprintf(w, "# HELP loggatherer_last_run_timestamp_seconds Time the run ended.\n# TYPE loggatherer_last_run_timestamp_seconds gauge\nloggatherer_last_run_timestamp_seconds %d\n", time.Now().Unix())
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// labelValue escapes s for use as a label value.
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// notifyTimeout is how long sending the notification may take.
+const notifyTimeout = 10 * time.Second
+
+// notification is the JSON payload posted to -notify-url at the end of a gather, and the data
+// the -notify-template body is rendered with. Its text is what Slack shows for an incoming
+// webhook.
+type notification struct {
+	Text         string    `json:"text"`
+	Success      bool      `json:"success"`
+	Result       outcome   `json:"result"`
+	ExitCode     int       `json:"exit_code"`
+	Host         string    `json:"host"`
+	Clusters     []string  `json:"clusters"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Matched      int       `json:"matched"`
+	Copied       int       `json:"copied"`
+	Errors       int       `json:"errors"`
+	BytesRead    int64     `json:"bytes_read"`
+	BytesWritten int64     `json:"bytes_written"`
+	Duration     float64   `json:"duration_seconds"`
+}
+
+// notifyPresets are the built-in -notify-template bodies.
+var notifyPresets = map[string]string{
+	"generic-json": "{{json .}}",
+	"slack":        `{"text": {{json .Text}}}`,
+}
+
+var (
+	notifyTmpl    = template.Must(newNotifyTemplate().Parse(notifyPresets["generic-json"]))
+	notifyHeaders http.Header // -notify-headers
+)
+
+// newNotifyTemplate returns an empty -notify-template body template, with the json function
+// writing its argument as JSON, so the values in a JSON body are always quoted correctly.
+func newNotifyTemplate() *template.Template {
+	return template.New("notify").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	})
+}
+
+// parseNotifyTemplate returns the -notify-template body named by spec: one of notifyPresets, or
+// the text/template in the file spec, relative to the folder of the configuration file. It is
+// rendered once with an empty notification, so a field which does not exist is reported at
+// startup instead of after the gather.
+func parseNotifyTemplate(spec string) (*template.Template, error) {
+	text, ok := notifyPresets[spec]
+	if !ok {
+		path := spec
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read notify template: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := newNotifyTemplate().Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify template %q: %v", spec, err)
+	}
+	if err := tmpl.Execute(io.Discard, notification{}); err != nil {
+		return nil, fmt.Errorf("invalid notify template %q: %v", spec, err)
+	}
+	return tmpl, nil
+}
+
+// parseNotifyHeaders parses the comma-separated "Name: value" headers of -notify-headers.
+func parseNotifyHeaders(list string) (http.Header, error) {
+	h := make(http.Header)
+	for _, item := range strings.Split(list, ",") {
+		if len(strings.TrimSpace(item)) == 0 {
+			continue
+		}
+		name, value, ok := strings.Cut(item, ":")
+		if name = strings.TrimSpace(name); !ok || len(name) == 0 || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid notify header %q, expected Name: value", strings.TrimSpace(item))
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// notify posts the result and statistics of the gather of clusters, which exits with code, to
+// -notify-url as the -notify-template body with the -notify-headers, unless -notify-on failure
+// is set and the gather succeeded. A notification which cannot be sent is only logged.
+func notify(clusters []*gatherer.Cluster, stats gatherer.Stats, result outcome, code int, elapsed time.Duration) {
+	if len(notifyURL) == 0 || (notifyOn == "failure" && code == 0) {
+		return
+	}
+	t := stats.Totals()
+	host, _ := os.Hostname()
+	n := notification{
+		Success:      code == 0,
+		Result:       result,
+		ExitCode:     code,
+		Host:         host,
+		Start:        startTime,
+		End:          endTime,
+		Matched:      t.Matched,
+		Copied:       t.Copied,
+		Errors:       t.Errors,
+		BytesRead:    t.Read,
+		BytesWritten: t.Written,
+		Duration:     elapsed.Seconds(),
+	}
+	for _, cl := range clusters {
+		n.Clusters = append(n.Clusters, cl.Name)
+	}
+	n.Text = fmt.Sprintf("loggatherer on %s: %s gathering %s from %s to %s UTC, %d of %d matched file(s) copied, %d error(s)",
+		host, result, strings.Join(n.Clusters, ", "), startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"), t.Copied, t.Matched, t.Errors)
+	var body bytes.Buffer
+	if err := notifyTmpl.Execute(&body, n); err != nil {
+		logf("[error] cannot send the notification: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifyURL, &body)
+	if err != nil {
+		logf("[error] cannot send the notification: invalid -notify-url")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range notifyHeaders {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the URL of a webhook is its secret, so it is left out of the log
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		logf("[error] cannot send the notification: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		logf("[error] the notification was refused: %s", resp.Status)
+		return
+	}
+	logf("[info] sent the notification, result %s", result)
+}
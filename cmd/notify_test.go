@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+func TestNotifyTemplate(t *testing.T) {
+	defer func(u, o string, tm *template.Template, h http.Header, d string) {
+		notifyURL, notifyOn, notifyTmpl, notifyHeaders, configDir = u, o, tm, h, d
+	}(notifyURL, notifyOn, notifyTmpl, notifyHeaders, configDir)
+	configDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "teams.tmpl"), []byte(`{"title": "{{.Result}}", "copied": {{.Copied}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range map[string]string{"typo.tmpl": "{{.Copies}}", "unclosed.tmpl": "{{.Result"} {
+		if err := os.WriteFile(filepath.Join(configDir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		spec, headers string
+		want          func(body map[string]interface{}) bool // nil when spec or headers are rejected
+		header        string                                 // a header the notification must carry
+	}{
+		{"generic-json", "", func(b map[string]interface{}) bool {
+			return b["result"] == "partial" && b["copied"] == 2.0 && strings.HasPrefix(b["text"].(string), "loggatherer on ")
+		}, "Content-Type: application/json"},
+		{"slack", "Authorization: Bearer secret", func(b map[string]interface{}) bool {
+			return len(b) == 1 && strings.Contains(b["text"].(string), "2 of 3 matched file(s) copied")
+		}, "Authorization: Bearer secret"},
+		{"teams.tmpl", "Content-Type: application/vnd.teams+json, X-Source: loggatherer", func(b map[string]interface{}) bool {
+			return b["title"] == "partial" && b["copied"] == 2.0
+		}, "Content-Type: application/vnd.teams+json"},
+		{"typo.tmpl", "", nil, ""},
+		{"missing.tmpl", "", nil, ""},
+		{"unclosed.tmpl", "", nil, ""},
+		{"generic-json", "Bearer secret", nil, ""},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseNotifyTemplate(tt.spec)
+		var headers http.Header
+		if err == nil {
+			headers, err = parseNotifyHeaders(tt.headers)
+		}
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s with headers %q: accepted, want an error", tt.spec, tt.headers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s with headers %q: %v", tt.spec, tt.headers, err)
+			continue
+		}
+
+		var (
+			got    map[string]interface{}
+			header http.Header
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			data, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Errorf("%s: body %q is not JSON: %v", tt.spec, data, err)
+			}
+		}))
+		notifyURL, notifyOn, notifyTmpl, notifyHeaders = srv.URL, "always", tmpl, headers
+		stats := gatherer.Stats{Servers: []gatherer.ServerStats{{Cluster: "web", Server: "web01", Matched: 3, Copied: 2, Errors: 1}}}
+		notify([]*gatherer.Cluster{{Name: "web"}}, stats, outcomePartial, exitPartial, 0)
+		srv.Close()
+
+		if got == nil || !tt.want(got) {
+			t.Errorf("%s: notification %v", tt.spec, got)
+		}
+		name, value, _ := strings.Cut(tt.header, ": ")
+		if header.Get(name) != value {
+			t.Errorf("%s: header %s is %q, want %q", tt.spec, name, header.Get(name), value)
+		}
+	}
+}
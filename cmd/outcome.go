@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// outcome is the overall result of a gather.
+type outcome string
+
+const (
+	outcomeSuccess     outcome = "success"      // every matched file was gathered
+	outcomePartial     outcome = "partial"      // some servers or files failed
+	outcomeEmpty       outcome = "empty"        // no files matched
+	outcomeAborted     outcome = "aborted"      // stopped early by a timeout, a full destination or -fail-fast
+	outcomeInterrupted outcome = "interrupted"  // stopped by SIGINT or SIGTERM
+	outcomeConfigError outcome = "config-error" // the configuration or arguments are invalid
+	outcomeUnverified  outcome = "unverified"   // some copies do not match their manifest, with -require-verify
+)
+
+// runOutcome classifies the gather with the statistics stats once all servers are done.
+func runOutcome(stats gatherer.Stats) outcome {
+	t := stats.Totals()
+	switch {
+	case atomic.LoadInt32(&interrupted) == 1:
+		return outcomeInterrupted
+	case stats.DestinationFull || stats.Failed || len(stats.TimedOut) > 0:
+		return outcomeAborted
+	case t.Errors > 0:
+		return outcomePartial
+	case t.Matched == 0:
+		return outcomeEmpty
+	}
+	return outcomeSuccess
+}
+
+// exitCode returns the process exit code for o. A full destination is reported with its own
+// exit code instead of the one for aborted runs.
+func (o outcome) exitCode(destFull bool) int {
+	switch o {
+	case outcomePartial:
+		return exitPartial
+	case outcomeEmpty:
+		return exitEmpty
+	case outcomeAborted:
+		if destFull {
+			return exitDestinationFull
+		}
+		return exitAborted
+	case outcomeInterrupted:
+		return exitInterrupted
+	case outcomeConfigError:
+		return exitConfigError
+	case outcomeUnverified:
+		return exitUnverified
+	}
+	return 0
+}
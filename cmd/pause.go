@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+)
+
+// pauseGate holds back copies from starting while the gather is paused.
+type pauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+var gate = newPauseGate()
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// set pauses or resumes the gather.
+func (g *pauseGate) set(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == paused {
+		return
+	}
+	g.paused = paused
+	if paused {
+		logf("[info] pausing, copies in progress are finished but no new ones are started")
+	} else {
+		logf("[info] resuming")
+		g.cond.Broadcast()
+	}
+}
+
+// wait blocks for as long as the gather is paused.
+func (g *pauseGate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
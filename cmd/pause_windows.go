@@ -0,0 +1,5 @@
+package main
+
+// handlePauseSignals does nothing on Windows, which has no SIGUSR1 and SIGUSR2 to pause
+// and resume the gather with.
+func handlePauseSignals() {}
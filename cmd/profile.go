@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyProfile merges every "[section.profile]" overlay section into its base section, so that
+// keys of the overlay override those of the base. It fails when the ini file has no overlay
+// section for profile at all. A section with a dot in its name whose base section does not
+// exist, such as [eu.prod] without [eu], is a cluster rather than an overlay.
+func applyProfile(profile string) error {
+	var found bool
+	for _, sect := range cfg.Sections() {
+		base, p, ok := profileOverlay(sect.Name())
+		if !ok || p != profile {
+			continue
+		}
+		found = true
+		for _, k := range sect.Keys() {
+			cfg.Section(base).Key(k.Name()).SetValue(k.Value())
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(profiles(), ", "))
+	}
+	return nil
+}
+
+// profiles returns the names of all profiles which have at least one overlay section.
+func profiles() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, sect := range cfg.Sections() {
+		if _, p, ok := profileOverlay(sect.Name()); ok && !seen[p] {
+			seen[p] = true
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overlaySections returns the names of all profile overlay sections.
+func overlaySections() []string {
+	var names []string
+	for _, sect := range cfg.Sections() {
+		if _, _, ok := profileOverlay(sect.Name()); ok {
+			names = append(names, sect.Name())
+		}
+	}
+	return names
+}
+
+// profileOverlay splits the name of a profile overlay section into its base section and profile.
+// It returns false for sections which are no overlay, because there is no dot in their name or
+// no section before the dot.
+func profileOverlay(name string) (base, profile string, ok bool) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 || !cfg.HasSection(name[:i]) {
+		return name, "", false
+	}
+	return name[:i], name[i+1:], true
+}
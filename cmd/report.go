@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// report is the JSON document written by -report-json at the end of a gather, independent of
+// -log-format.
+type report struct {
+	Result   outcome       `json:"result"`
+	ExitCode int           `json:"exit_code"`
+	Host     string        `json:"host"`
+	Clusters []string      `json:"clusters"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration float64       `json:"duration_seconds"`
+	Totals   reportStats   `json:"totals"`
+	Servers  []reportStats `json:"servers"`
+}
+
+// reportStats are the statistics of a single server, or the totals of all of them, in the
+// report.
+type reportStats struct {
+	Cluster      string `json:"cluster,omitempty"`
+	Server       string `json:"server,omitempty"`
+	Matched      int    `json:"matched"`
+	Copied       int    `json:"copied"`
+	Skipped      int    `json:"skipped"`
+	Changed      int    `json:"changed"`
+	Compressed   int    `json:"compressed"`
+	BytesRead    int64  `json:"bytes_read"`
+	BytesWritten int64  `json:"bytes_written"`
+	Errors       int    `json:"errors"`
+}
+
+func newReportStats(s gatherer.ServerStats) reportStats {
+	return reportStats{
+		Cluster:      s.Cluster,
+		Server:       s.Server,
+		Matched:      s.Matched,
+		Copied:       s.Copied,
+		Skipped:      s.Skipped,
+		Changed:      s.Changed,
+		Compressed:   s.Compressed,
+		BytesRead:    s.Read,
+		BytesWritten: s.Written,
+		Errors:       s.Errors,
+	}
+}
+
+// writeReport writes the statistics stats of the gather of clusters, which exits with code after
+// elapsed, to path as a single JSON document. The file is replaced at once, so a job waiting
+// for it never reads a partial one.
+func writeReport(path string, clusters []*gatherer.Cluster, stats gatherer.Stats, result outcome, code int, elapsed time.Duration) error {
+	host, _ := os.Hostname()
+	r := report{
+		Result:   result,
+		ExitCode: code,
+		Host:     host,
+		Clusters: []string{},
+		Start:    startTime,
+		End:      endTime,
+		Duration: elapsed.Seconds(),
+		Totals:   newReportStats(stats.Totals()),
+		Servers:  []reportStats{},
+	}
+	for _, cl := range clusters {
+		r.Clusters = append(r.Clusters, cl.Name)
+	}
+	for _, s := range stats.Servers {
+		r.Servers = append(r.Servers, newReportStats(s))
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := gatherer.CreateFile(tmp, fileMode)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// checkFreeSpace stops the run before anything is copied when the volume of destination has less
+// free space than the gather with conf is expected to need, see gatherer.Estimate. It returns
+// false when the run has to stop.
+func checkFreeSpace(ctx context.Context, destination string, conf gatherer.Config) bool {
+	dir := destination
+	free, err := gatherer.FreeSpace(dir)
+	for errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+		// the destination is created by the gather, so check the volume it will be created on
+		dir = filepath.Dir(dir)
+		free, err = gatherer.FreeSpace(dir)
+	}
+	if err != nil {
+		logf("[warning] cannot determine the free space on destination %q, gathering without checking it: %v", destination, err)
+		return true
+	}
+	conf.CompressRatio = cfg.Section("default").Key("compress_ratio").MustFloat64(4)
+	need, err := gatherer.Estimate(ctx, conf)
+	if err != nil {
+		logf("[warning] cannot estimate the size of the gather, gathering without checking the free space: %v", err)
+		return true
+	}
+	logf("[info] the gather needs about %d bytes, %d bytes are free on destination %q", need, free, destination)
+	if uint64(need) <= free {
+		return true
+	}
+	logf("[fatal] destination %q has %d bytes free, but the gather needs about %d bytes (use -force to gather anyway)", destination, free, need)
+	fmt.Fprintf(os.Stderr, "destination %q has %d bytes free, but the gather needs about %d bytes (use -force to gather anyway)\n", destination, free, need)
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// logSummary logs the totals and the per-cluster and per-server statistics of the run.
+func logSummary(result outcome, stats gatherer.Stats, elapsed time.Duration) {
+	t := stats.Totals()
+	ratio := ""
+	if outputFormat != "none" && t.Written > 0 {
+		ratio = fmt.Sprintf(", compression ratio %.2f", float64(t.Read)/float64(t.Written))
+	}
+	reportf("[info] summary: %s, %d of %d matched file(s) copied%s, %d bytes read, %d bytes written%s, %d error(s), elapsed %s",
+		result, t.Copied, t.Matched, notes(&t), t.Read, t.Written, ratio, t.Errors, elapsed.Round(time.Millisecond))
+	if skipExisting && skipMode == "hash" {
+		reportf("[info] summary: -skip-existing -skip-mode hash skips files whose content did not change since the copy recorded in the manifest of the window folder")
+	} else if skipExisting {
+		reportf("[info] summary: -skip-existing skips files whose copy has the same size and modification time, or the same modification time for compressed copies")
+	}
+
+	clusters := make(map[string]*gatherer.ServerStats)
+	for i := range stats.Servers {
+		s := &stats.Servers[i]
+		if clusters[s.Cluster] == nil {
+			clusters[s.Cluster] = &gatherer.ServerStats{}
+		}
+		clusters[s.Cluster].Add(s)
+	}
+	for i, s := range stats.Servers {
+		if i == 0 || stats.Servers[i-1].Cluster != s.Cluster {
+			c := clusters[s.Cluster]
+			reportf("[info] summary[%s]: %d of %d matched file(s) copied%s, %d bytes read, %d bytes written, %d error(s)",
+				s.Cluster, c.Copied, c.Matched, notes(c), c.Read, c.Written, c.Errors)
+		}
+		reportf("[info] summary[%s/%s]: %d of %d matched file(s) copied%s, %d bytes read, %d bytes written, %d error(s)",
+			s.Cluster, s.Server, s.Copied, s.Matched, notes(&s), s.Read, s.Written, s.Errors)
+	}
+}
+
+// notes returns the compressed, skipped and changed notes of s for the summary.
+func notes(s *gatherer.ServerStats) string {
+	return compressedNote(s) + skippedNote(s) + changedNote(s)
+}
+
+// compressedNote returns how many of the copied files were compressed for the summary, if
+// -compress-min-size leaves the smaller ones uncompressed.
+func compressedNote(s *gatherer.ServerStats) string {
+	if outputFormat == "none" || compressMin <= 0 || outputFormat == "tar.gz" {
+		return ""
+	}
+	return fmt.Sprintf(", %d of them compressed", s.Compressed)
+}
+
+// skippedNote returns the number of skipped files for the summary, if -skip-existing,
+// -no-clobber-newer or -on-exists skip is set.
+func skippedNote(s *gatherer.ServerStats) string {
+	if !skipExisting && !noClobber && onExists != "skip" {
+		return ""
+	}
+	return fmt.Sprintf(", %d skipped", s.Skipped)
+}
+
+// changedNote returns the number of files which changed while they were copied for the summary,
+// if there were any.
+func changedNote(s *gatherer.ServerStats) string {
+	if s.Changed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d changed during the copy)", s.Changed)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// durationKeys are the keys of the [default] section and of the cluster sections which hold a
+// duration.
+var durationKeys = map[string][]string{
+	"default": {"duration", "timeout", "retry_delay", "progress_interval", "lock_max_age"},
+	"cluster": {"retention", "clock_offset"},
+}
+
+// validateConfig checks the configuration in cfg for the clusters selected by -cluster or the
+// cluster key and returns every problem found, so they can all be reported at once.
+func validateConfig(cfg *ini.File) []error {
+	var errs []error
+	def := cfg.Section("default")
+	if len(strings.TrimSpace(def.Key("destination").Value())) == 0 {
+		errs = append(errs, fmt.Errorf("no destination configured in the [default] section"))
+	}
+	errs = append(errs, validateValues(def, durationKeys["default"])...)
+	if _, err := gatherer.ParseCompressLevel(def.Key("compress_level").Value()); err != nil {
+		errs = append(errs, fmt.Errorf("[default] compress_level: %v", err))
+	}
+	for _, key := range []string{"min_size", "max_size", "max_total_size", "compress_min_size"} {
+		if _, err := gatherer.ParseSize(def.Key(key).Value()); err != nil {
+			errs = append(errs, fmt.Errorf("[default] %s: %v", key, err))
+		}
+	}
+	for _, key := range []string{"dir_mode", "file_mode"} {
+		if _, err := gatherer.ParseMode(def.Key(key).Value(), 0); err != nil {
+			errs = append(errs, fmt.Errorf("[default] %s: %v", key, err))
+		}
+	}
+	for _, key := range []string{"rate_limit", "server_rate_limit"} {
+		if _, err := gatherer.ParseRate(def.Key(key).Value()); err != nil {
+			errs = append(errs, fmt.Errorf("[default] %s: %v", key, err))
+		}
+	}
+	if k, err := def.GetKey("compress_ratio"); err == nil {
+		if r, err := k.Float64(); err != nil || r < 1 {
+			errs = append(errs, fmt.Errorf("[default] compress_ratio: invalid ratio %q, expected a number of at least 1", k.Value()))
+		}
+	}
+	switch v := def.Key("notify_on").MustString("always"); v {
+	case "always", "failure":
+	default:
+		errs = append(errs, fmt.Errorf("[default] notify_on: invalid value %q, expected always or failure", v))
+	}
+	if _, err := parseNotifyTemplate(def.Key("notify_template").MustString("generic-json")); err != nil {
+		errs = append(errs, fmt.Errorf("[default] notify_template: %v", err))
+	}
+	if _, err := parseNotifyHeaders(def.Key("notify_headers").Value()); err != nil {
+		errs = append(errs, fmt.Errorf("[default] notify_headers: %v", err))
+	}
+	for _, key := range []string{"retry_on", "no_retry_on"} {
+		if _, err := gatherer.ParseErrorPatterns(def.Key(key).Value()); err != nil {
+			errs = append(errs, fmt.Errorf("[default] %s: %v", key, err))
+		}
+	}
+	switch v := def.Key("skip_mode").MustString("mtime"); v {
+	case "mtime", "hash":
+	default:
+		errs = append(errs, fmt.Errorf("[default] skip_mode: invalid value %q, expected mtime or hash", v))
+	}
+	switch v := def.Key("on_exists").MustString("overwrite"); v {
+	case "overwrite", "skip", "rename":
+	default:
+		errs = append(errs, fmt.Errorf("[default] on_exists: invalid value %q, expected overwrite, skip or rename", v))
+	}
+	if _, err := gatherer.ParseFolderFormat(def.Key("folder_format").MustString(gatherer.DefaultFolderFormat)); err != nil {
+		errs = append(errs, fmt.Errorf("[default] folder_format: %v", err))
+	}
+
+	names := clusterNames(cluster)
+	if len(names) == 0 {
+		errs = append(errs, fmt.Errorf("no cluster specified with -cluster or the cluster key"))
+	}
+	for _, name := range names {
+		sect, err := cfg.GetSection(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unknown cluster %q", name))
+			continue
+		}
+		shares := logShares(sect.Key("logshare").MustString(def.Key("logshare").Value()))
+		if len(shares) == 0 {
+			errs = append(errs, fmt.Errorf("no logshare configured for cluster %q or in the [default] section", name))
+		}
+		folders := make(map[string]bool)
+		for _, logshare := range shares {
+			if folder := gatherer.ShareFolder(logshare); folders[folder] {
+				errs = append(errs, fmt.Errorf("[%s] logshare: %q is listed more than once", name, logshare))
+			} else {
+				folders[folder] = true
+			}
+		}
+		errs = append(errs, validateValues(sect, durationKeys["cluster"])...)
+		owners := ownerList
+		if k, err := sect.GetKey("owners"); err == nil && len(owners) == 0 {
+			owners = k.Value()
+		}
+		username := def.Key("username").Value()
+		if k, err := sect.GetKey("username"); err == nil {
+			username = k.Value()
+		}
+		if len(strings.TrimSpace(owners)) > 0 && len(username) > 0 {
+			errs = append(errs, fmt.Errorf("[%s] owners cannot be combined with username, the owner of a file cannot be read over an SMB session", name))
+		}
+		if k, err := sect.GetKey("server_rate_limit"); err == nil {
+			if _, err := gatherer.ParseRate(k.Value()); err != nil {
+				errs = append(errs, fmt.Errorf("[%s] server_rate_limit: %v", name, err))
+			}
+		}
+		servers, err := clusterServers(sect)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[%s] servers_file: %v", name, err))
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, e := range servers {
+			if seen[e.name] {
+				errs = append(errs, fmt.Errorf("[%s] server %q is listed more than once", name, e.name))
+			}
+			seen[e.name] = true
+			if host, _, _ := strings.Cut(e.value, "|"); len(strings.TrimSpace(host)) == 0 {
+				errs = append(errs, fmt.Errorf("[%s] server %q has no host", name, e.name))
+			}
+		}
+		if len(servers) == 0 {
+			errs = append(errs, fmt.Errorf("cluster %q has no servers", name))
+		}
+	}
+	return errs
+}
+
+// validateValues checks the glob patterns in sect and the durations of its keys durations. Keys
+// are looked up without creating them, as missing keys of a cluster section would be servers.
+func validateValues(sect *ini.Section, durations []string) []error {
+	var errs []error
+	for _, key := range durations {
+		if k, err := sect.GetKey(key); err == nil && len(k.Value()) > 0 {
+			if _, err := time.ParseDuration(k.Value()); err != nil {
+				errs = append(errs, fmt.Errorf("[%s] %s: %v", sect.Name(), key, err))
+			}
+		}
+	}
+	for _, key := range []string{"include", "exclude"} {
+		if k, err := sect.GetKey(key); err == nil {
+			if _, err := gatherer.ParsePatterns(k.Value()); err != nil {
+				errs = append(errs, fmt.Errorf("[%s] %s: invalid pattern %v", sect.Name(), key, err))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+// verifyManifest checks every copy listed in the manifest of the window folder against the
+// SHA-256 recorded when it was gathered, and returns the paths of the missing or mismatching
+// copies. Only a manifest which cannot be read is returned as error.
+func verifyManifest(folder string) ([]string, error) {
+	entries, err := gatherer.ReadManifest(folder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest in %q: %w", folder, err)
+	}
+	var (
+		checked int
+		bad     []string
+	)
+	for _, e := range entries {
+		if len(e.SHA256) == 0 {
+			continue
+		}
+		checked++
+		sum, err := hashCopy(folder, e)
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("%s/%s", folder, e.Copy))
+			logf("[error][%s] cannot verify copy %q of %q: %v", e.Server, e.Copy, e.Path, err)
+			continue
+		}
+		if hex.EncodeToString(sum) != e.SHA256 {
+			bad = append(bad, fmt.Sprintf("%s/%s", folder, e.Copy))
+			logf("[error][%s] checksum of copy %q does not match the one of %q", e.Server, e.Copy, e.Path)
+		}
+	}
+	logf("[info] verified %d of %d copies in %q, %d missing or mismatching", checked-len(bad), checked, fileName(folder), len(bad))
+	return bad, nil
+}
+
+// verifyClusters checks the copies in the window folders of clusters once they are gathered,
+// for -require-verify, and returns the ones which could not be verified. A manifest which cannot
+// be read is returned instead of the copies it lists.
+func verifyClusters(clusters []*gatherer.Cluster) []string {
+	var bad []string
+	for _, cl := range clusters {
+		b, err := verifyManifest(cl.Destination)
+		if err != nil {
+			logf("[error] %v", err)
+			b = []string{fmt.Sprintf("%s/manifest.%s", cl.Destination, manifestFmt)}
+		}
+		bad = append(bad, b...)
+	}
+	return bad
+}
+
+// logUnverified lists the copies which could not be verified at the end of the summary.
+func logUnverified(bad []string) {
+	reportf("[error] summary: %d copies could not be verified against their manifest", len(bad))
+	for _, b := range bad {
+		reportf("[error] summary: unverified %s", fileName(b))
+	}
+}
+
+// hashCopy returns the SHA-256 of the copy of e in the window folder, decompressing it when it
+// was compressed.
+func hashCopy(folder string, e gatherer.ManifestEntry) ([]byte, error) {
+	if archive, name, ok := strings.Cut(e.Copy, ".tar.gz:"); ok {
+		return hashTarEntry(fmt.Sprintf("%s/%s.tar.gz", folder, archive), name)
+	}
+	archive, name, ok := strings.Cut(e.Copy, ".zip:")
+	if !ok {
+		return gatherer.HashFile(fmt.Sprintf("%s/%s", folder, e.Copy), e.Compressed)
+	}
+	zr, err := zip.OpenReader(fmt.Sprintf("%s/%s.zip", folder, archive))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// hashTarEntry returns the SHA-256 of the entry name of the gzipped tar archive at path.
+func hashTarEntry(path, name string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == name {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, err
+			}
+			return h.Sum(nil), nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ipsos.com/utils/loggatherer/gatherer"
+)
+
+func TestVerifyClusters(t *testing.T) {
+	defer func(m string) { manifestFmt = m }(manifestFmt)
+	manifestFmt = "json"
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, window string) // before the window folder is verified
+		want   []string                          // relative to the window folder
+	}{
+		{"verified", func(*testing.T, string) {}, nil},
+		{"mismatch", func(t *testing.T, window string) {
+			if err := os.WriteFile(filepath.Join(window, "web01", "b.tmp"), []byte("changed"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"web01/b.tmp"}},
+		{"missing", func(t *testing.T, window string) {
+			if err := os.Remove(filepath.Join(window, "web01", "a.tmp")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"web01/a.tmp"}},
+		{"no manifest", func(t *testing.T, window string) {
+			if err := os.Remove(filepath.Join(window, "manifest.json")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"manifest.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := filepath.ToSlash(t.TempDir())
+			var entries []gatherer.ManifestEntry
+			for _, name := range []string{"a.tmp", "b.tmp"} {
+				data := []byte(name)
+				if err := os.MkdirAll(filepath.Join(window, "web01"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(window, "web01", name), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(data)
+				entries = append(entries, gatherer.ManifestEntry{Server: "web01", Path: "//web01/logs/" + name, Copy: "web01/" + name, SHA256: hex.EncodeToString(sum[:])})
+			}
+			data, err := json.Marshal(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(window, "manifest.json"), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, window)
+
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, window+"/"+w)
+			}
+			if got := verifyClusters([]*gatherer.Cluster{{Name: "web", Destination: window}}); !reflect.DeepEqual(got, want) {
+				t.Errorf("unverified %q, want %q", got, want)
+			}
+		})
+	}
+	if code := outcomeUnverified.exitCode(false); code != exitUnverified {
+		t.Errorf("exit code %d for unverified copies, want %d", code, exitUnverified)
+	}
+}
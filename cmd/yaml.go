@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// loadYAML loads the YAML configuration file at path into the same sections and keys an ini
+// file would have, so that both behave the same:
+//
+//	default:
+//	  destination: D:/logs
+//	  suffixes: [.tmp, .log]
+//	clusters:
+//	  web:
+//	    logshare: logs
+//	    servers:
+//	      web01: host01
+//	      web02: {host: host02, alias: w2}
+//	web.nightly:
+//	  retention: 720h
+//
+// Every top-level mapping other than clusters is a section, lists are joined with commas and
+// the servers of a cluster become its server keys, with host|alias when an alias is given.
+func loadYAML(path string) (*ini.File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseYAML(path, data)
+}
+
+// parseYAML parses the YAML configuration data like loadYAML, path is only used in errors.
+func parseYAML(path string, data []byte) (*ini.File, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	f := ini.Empty()
+	if len(doc.Content) == 0 {
+		return f, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: line %d: expected a mapping of sections", path, root.Line)
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		name, body := root.Content[i].Value, root.Content[i+1]
+		if body.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: line %d: expected the keys of section %q", path, body.Line, name)
+		}
+		if name != "clusters" {
+			if err := addYAMLSection(f, name, body, false); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			continue
+		}
+		for j := 0; j < len(body.Content); j += 2 {
+			cluster := body.Content[j+1]
+			if cluster.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s: line %d: expected the settings of cluster %q", path, cluster.Line, body.Content[j].Value)
+			}
+			if err := addYAMLSection(f, body.Content[j].Value, cluster, true); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// addYAMLSection adds the keys of the mapping body to the section name of f. For a cluster, the
+// servers mapping adds the server keys.
+func addYAMLSection(f *ini.File, name string, body *yaml.Node, cluster bool) error {
+	sect, err := f.NewSection(name)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(body.Content); i += 2 {
+		key, value := body.Content[i].Value, body.Content[i+1]
+		if cluster && key == "servers" {
+			if err := addYAMLServers(sect, value); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := yamlValue(value)
+		if err != nil {
+			return fmt.Errorf("line %d: [%s] %s: %w", value.Line, name, key, err)
+		}
+		if _, err := sect.NewKey(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addYAMLServers adds a key to sect for every server of the mapping servers, whose value is
+// either the host or a mapping with a host and an optional alias.
+func addYAMLServers(sect *ini.Section, servers *yaml.Node) error {
+	if servers.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: [%s] servers: expected a mapping of server names to hosts", servers.Line, sect.Name())
+	}
+	for i := 0; i < len(servers.Content); i += 2 {
+		name, value := servers.Content[i].Value, servers.Content[i+1]
+		host := value.Value
+		if value.Kind == yaml.MappingNode {
+			var s struct{ Host, Alias string }
+			if err := value.Decode(&s); err != nil {
+				return fmt.Errorf("line %d: [%s] server %q: %w", value.Line, sect.Name(), name, err)
+			}
+			host = s.Host
+			if len(s.Alias) > 0 {
+				host = fmt.Sprintf("%s|%s", s.Host, s.Alias)
+			}
+		} else if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: [%s] server %q: expected a host or a mapping with a host and alias", value.Line, sect.Name(), name)
+		}
+		if clusterOptions[name] {
+			return fmt.Errorf("line %d: [%s] server %q has the name of a cluster setting", servers.Content[i].Line, sect.Name(), name)
+		}
+		if _, err := sect.NewKey(name, host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlValue returns the ini value of a scalar or a list of scalars, which is joined with commas.
+func yamlValue(n *yaml.Node) (string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return n.Value, nil
+	case yaml.SequenceNode:
+		var items []string
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("expected a list of values")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("expected a value or a list of values")
+}
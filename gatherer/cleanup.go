@@ -0,0 +1,114 @@
+package gatherer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Folder is a period folder below the destination of a cluster.
+type Folder struct {
+	Path string
+	End  time.Time // end of the period of the folder
+	Size int64     // total size of the files in and below the folder
+	Keep bool      // one of the most recent folders, which are never removed
+}
+
+// PeriodFolders returns the period folders of cluster in dir named by format, most recent first,
+// of which the keep most recent ones are marked to be kept. Other entries of dir are ignored.
+func PeriodFolders(dir string, format *FolderFormat, cluster string, keep int) ([]Folder, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var folders []Folder
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, end, ok := format.Parse(cluster, entry.Name()); ok {
+			path := fmt.Sprintf("%s/%s", dir, entry.Name())
+			folders = append(folders, Folder{Path: path, End: end, Size: FolderSize(path)})
+		}
+	}
+	sort.SliceStable(folders, func(i, j int) bool { return folders[i].End.After(folders[j].End) })
+	for i := 0; i < keep && i < len(folders); i++ {
+		folders[i].Keep = true
+	}
+	return folders, nil
+}
+
+// LastEnd returns the latest end of the periods of the period folders of cluster in dir named
+// by format, and false when there are none. A missing dir has no period folders.
+func LastEnd(dir string, format *FolderFormat, cluster string) (time.Time, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var last time.Time
+	found := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, end, ok := format.Parse(cluster, entry.Name()); ok && (!found || end.After(last)) {
+			last, found = end, true
+		}
+	}
+	return last, found, nil
+}
+
+// Expired returns the folders whose period ended more than retention before now, apart from the
+// ones to keep.
+func Expired(folders []Folder, retention time.Duration, now time.Time) []Folder {
+	var expired []Folder
+	for _, f := range folders {
+		if !f.Keep && f.End.Before(now.Add(-retention)) {
+			expired = append(expired, f)
+		}
+	}
+	return expired
+}
+
+// OverBudget returns the oldest folders, apart from the ones to keep, to remove to bring the total
+// size of folders down to at most budget bytes, and the total size of the folders left.
+func OverBudget(folders []Folder, budget int64) ([]Folder, int64) {
+	var total int64
+	for _, f := range folders {
+		total += f.Size
+	}
+	oldest := append([]Folder(nil), folders...)
+	sort.SliceStable(oldest, func(i, j int) bool { return oldest[i].End.Before(oldest[j].End) })
+	var remove []Folder
+	for _, f := range oldest {
+		if total <= budget {
+			break
+		}
+		if !f.Keep {
+			remove = append(remove, f)
+			total -= f.Size
+		}
+	}
+	return remove, total
+}
+
+// FolderSize returns the total size of the files in and below folder.
+func FolderSize(folder string) int64 {
+	var size int64
+	filepath.WalkDir(folder, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,155 @@
+package gatherer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// periodDir creates period folders in a temp dir, holding a file of 10 bytes per day since the
+// start of February 2023, and some entries which are not period folders.
+func periodDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"20230201T100000Z-20230201T120000Z", // ended 9 days ago, 10 bytes
+		"20230203T100000Z-20230203T120000Z", // ended exactly 7 days ago, 30 bytes
+		"20230209T100000Z-20230209T120000Z", // ended 1 day ago, 90 bytes
+		"web01",
+	} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, end, ok := defaultFormat(t).Parse("c1", name); ok {
+			if err := os.WriteFile(filepath.Join(dir, name, "a.tmp"), make([]byte, 10*end.Day()), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// files are never removed, even when named like a period folder
+	if err := os.WriteFile(filepath.Join(dir, "20230101T100000Z-20230101T120000Z"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPeriodFolders(t *testing.T) {
+	dir := periodDir(t)
+	folders, err := PeriodFolders(dir, defaultFormat(t), "c1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Folder{
+		{dir + "/20230209T100000Z-20230209T120000Z", time.Date(2023, 2, 9, 12, 0, 0, 0, time.UTC), 90, true},
+		{dir + "/20230203T100000Z-20230203T120000Z", time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC), 30, true},
+		{dir + "/20230201T100000Z-20230201T120000Z", time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC), 10, false},
+	}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("PeriodFolders = %+v, want %+v", folders, want)
+	}
+
+	if _, err := PeriodFolders(filepath.Join(dir, "missing"), defaultFormat(t), "c1", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PeriodFolders of a missing folder: got %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestLastEnd(t *testing.T) {
+	dir := periodDir(t)
+	last, ok, err := LastEnd(dir, defaultFormat(t), "c1")
+	if want := time.Date(2023, 2, 9, 12, 0, 0, 0, time.UTC); err != nil || !ok || !last.Equal(want) {
+		t.Errorf("LastEnd = %s, %t, %v, want %s, true, nil", last, ok, err, want)
+	}
+	if _, ok, err := LastEnd(filepath.Join(dir, "web01"), defaultFormat(t), "c1"); err != nil || ok {
+		t.Errorf("LastEnd without period folders = %t, %v, want false, nil", ok, err)
+	}
+	if _, ok, err := LastEnd(filepath.Join(dir, "missing"), defaultFormat(t), "c1"); err != nil || ok {
+		t.Errorf("LastEnd of a missing folder = %t, %v, want false, nil", ok, err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	dir := periodDir(t)
+	now := time.Date(2023, 2, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		retention time.Duration
+		keep      int
+		want      []string
+	}{
+		{0, 0, []string{"20230201T100000Z-20230201T120000Z", "20230203T100000Z-20230203T120000Z", "20230209T100000Z-20230209T120000Z"}},
+		{7 * 24 * time.Hour, 0, []string{"20230201T100000Z-20230201T120000Z"}},
+		{30 * 24 * time.Hour, 0, nil},
+		{0, 1, []string{"20230201T100000Z-20230201T120000Z", "20230203T100000Z-20230203T120000Z"}},
+		{0, 2, []string{"20230201T100000Z-20230201T120000Z"}},
+		{0, 5, nil},
+		{48 * time.Hour, 1, []string{"20230201T100000Z-20230201T120000Z", "20230203T100000Z-20230203T120000Z"}},
+		{8 * 24 * time.Hour, 1, []string{"20230201T100000Z-20230201T120000Z"}},
+	}
+	for _, tt := range tests {
+		folders, err := PeriodFolders(dir, defaultFormat(t), "c1", tt.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range Expired(folders, tt.retention, now) {
+			got = append(got, filepath.Base(f.Path))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expired with retention %s, keep %d = %q, want %q", tt.retention, tt.keep, got, tt.want)
+		}
+	}
+}
+
+func TestOverBudget(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 2, d, 12, 0, 0, 0, time.UTC) }
+	folders := []Folder{
+		{Path: "c", End: day(3), Size: 30, Keep: true},
+		{Path: "b", End: day(2), Size: 20},
+		{Path: "a", End: day(1), Size: 10},
+	}
+
+	tests := []struct {
+		budget int64
+		want   []string
+		total  int64
+	}{
+		{100, nil, 60},
+		{60, nil, 60},
+		{59, []string{"a"}, 50},
+		{50, []string{"a"}, 50},
+		{40, []string{"a", "b"}, 30},
+		{0, []string{"a", "b"}, 30}, // the most recent folder is kept, even over budget
+	}
+	for _, tt := range tests {
+		remove, total := OverBudget(folders, tt.budget)
+		var got []string
+		for _, f := range remove {
+			got = append(got, f.Path)
+		}
+		if !reflect.DeepEqual(got, tt.want) || total != tt.total {
+			t.Errorf("OverBudget(%d) = %q, %d, want %q, %d", tt.budget, got, total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestFolderSize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "web01", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, size := range map[string]int{"a.tmp": 10, "web01/b.tmp": 20, "web01/sub/c.tmp": 30} {
+		if err := os.WriteFile(filepath.Join(dir, path), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := FolderSize(dir); got != 60 {
+		t.Errorf("FolderSize = %d, want 60", got)
+	}
+	if got := FolderSize(filepath.Join(dir, "missing")); got != 0 {
+		t.Errorf("FolderSize of a missing folder = %d, want 0", got)
+	}
+}
@@ -0,0 +1,79 @@
+package gatherer
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Cluster holds the settings of a single cluster to gather from.
+type Cluster struct {
+	Name            string
+	Destination     string   // window folder of the cluster
+	Shares          []string // log shares of the servers, the logshare key
+	Username        string   // SMB credentials for the log shares, the current session when empty
+	Password        string
+	Domain          string
+	Filter          Filter
+	Owners          map[string]bool // upper case owners whose files are gathered, all when empty
+	Servers         []*Server
+	Parallel        int   // number of files copied from a single server at the same time
+	ServerRateLimit int64 // bytes per second read from each server, 0 means no limit
+}
+
+// Server is a single server entry of a cluster section.
+type Server struct {
+	Name    string // key in the cluster section
+	Host    string // host used to build the share path
+	Folder  string // name of the destination folder
+	Cluster *Cluster
+
+	share share        // log share, while gathering from the server
+	limit *rateLimiter // ServerRateLimit of the cluster, nil when not set
+
+	logshare string // the one of the shares of the cluster being gathered
+}
+
+// src returns the path of the log share of the server.
+func (srv *Server) src() string {
+	return fmt.Sprintf("//%s/%s", srv.Host, srv.logshare)
+}
+
+// shareFolder returns the folder below the one of a server to copy the files of logshare to, or
+// "" when its cluster only has a single share, whose files go into the server folder themselves.
+func (srv *Server) shareFolder(logshare string) string {
+	if len(srv.Cluster.Shares) == 1 {
+		return ""
+	}
+	return ShareFolder(logshare)
+}
+
+// ShareFolder returns the slash-separated path of logshare, which names its folder.
+func ShareFolder(logshare string) string {
+	return strings.Trim(strings.ReplaceAll(logshare, `\`, "/"), "/")
+}
+
+// listedShare returns the log share of srv holding the file at the path p of a -files list,
+// and the path of the file relative to that share. With more than one share, paths start with
+// the folder of the share, like the copies do.
+func (srv *Server) listedShare(p string) (logshare, rel string, ok bool) {
+	if len(srv.Cluster.Shares) == 1 {
+		return srv.Cluster.Shares[0], p, true
+	}
+	for _, logshare := range srv.Cluster.Shares {
+		if prefix := srv.shareFolder(logshare) + "/"; strings.HasPrefix(p, prefix) {
+			return logshare, p[len(prefix):], true
+		}
+	}
+	return "", "", false
+}
+
+// open opens the source file at path, which is below src, on the log share of the server.
+func (srv *Server) open(path string) (fs.File, error) {
+	return srv.share.Open(srv.rel(path))
+}
+
+// rel returns the path of the source file at path relative to the log share of the server.
+func (srv *Server) rel(path string) string {
+	return strings.TrimPrefix(path, srv.src()+"/")
+}
@@ -0,0 +1,114 @@
+package gatherer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// combinedLine is a single record of the NDJSON output written by -combine ndjson.
+type combinedLine struct {
+	Server string `json:"server"`
+	File   string `json:"file"`
+	Line   string `json:"line"`
+}
+
+// combiner writes the lines of all text logs of a single server to one NDJSON file. The file is
+// only created once the first log is added.
+type combiner struct {
+	run  *run
+	srv  *Server
+	path string
+	f    *os.File
+	cw   *countingWriter
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+func (r *run) newCombiner(srv *Server, path string) *combiner {
+	return &combiner{run: r, srv: srv, path: path}
+}
+
+// add appends the lines of the source file at path to the combined output. It returns false,
+// without writing anything, when the file is too large or not a text file and should be copied
+// normally instead.
+func (c *combiner) add(ctx context.Context, path string, finfo os.FileInfo) bool {
+	if finfo.Size() > c.run.CombineMax {
+		return false
+	}
+	s, err := c.srv.open(path)
+	if err != nil {
+		c.run.logf("[error][%s] cannot open source file %q: %v", c.srv.Name, FileName(finfo.Name()), err)
+		c.run.countError(c.srv)
+		return true
+	}
+	defer s.Close()
+
+	br := bufio.NewReader(c.run.throttle(ctx, c.srv, s))
+	head, _ := br.Peek(8000)
+	if bytes.IndexByte(head, 0) >= 0 || len(compression(finfo.Name(), head)) > 0 {
+		return false
+	}
+	if c.f == nil {
+		if c.f, err = CreateFile(c.path, c.run.FileMode); err != nil {
+			c.run.logf("[error][%s] cannot create combined output %q: %v", c.srv.Name, FileName(c.path), err)
+			c.run.countError(c.srv)
+			if IsDiskFull(err) {
+				c.run.markDestinationFull(c.srv.Name, err)
+			}
+			return true
+		}
+		c.cw = &countingWriter{w: c.f}
+		c.w = bufio.NewWriter(c.cw)
+		c.enc = json.NewEncoder(c.w)
+		c.enc.SetEscapeHTML(false)
+	}
+
+	rec := combinedLine{Server: c.srv.Name, File: finfo.Name()}
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			rec.Line = strings.TrimRight(line, "\r\n")
+			if err := c.enc.Encode(rec); err != nil {
+				c.run.logf("[error][%s] cannot write combined output %q: %v", c.srv.Name, FileName(c.path), err)
+				c.run.countError(c.srv)
+				if IsDiskFull(err) {
+					c.run.markDestinationFull(c.srv.Name, err)
+				}
+				return true
+			}
+		}
+		if err == io.EOF {
+			c.run.countCopied(c.srv, finfo.Size(), 0)
+			c.run.addManifest(c.srv, finfo, ManifestEntry{Path: path, Copy: fmt.Sprintf("%s.ndjson", c.srv.Folder)})
+			break
+		}
+		if err != nil {
+			c.run.logf("[error][%s] cannot read source file %q: %v", c.srv.Name, FileName(finfo.Name()), err)
+			c.run.countError(c.srv)
+			break
+		}
+	}
+	return true
+}
+
+// close flushes and closes the combined output, if it was created.
+func (c *combiner) close() {
+	if c.f == nil {
+		return
+	}
+	if err := c.w.Flush(); err != nil {
+		c.run.logf("[error][%s] cannot write combined output %q: %v", c.srv.Name, FileName(c.path), err)
+		c.run.countError(c.srv)
+		if IsDiskFull(err) {
+			c.run.markDestinationFull(c.srv.Name, err)
+		}
+	}
+	c.f.Close()
+	c.run.record(c.srv, func(s *ServerStats) { s.Written += c.cw.n })
+}
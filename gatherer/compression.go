@@ -0,0 +1,160 @@
+package gatherer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic numbers of compressed file formats
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicZip   = []byte("PK\x03\x04")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// compressedExts maps the extensions of already compressed files to their format.
+var compressedExts = map[string]string{
+	".gz":  "gzip",
+	".tgz": "gzip",
+	".zip": "zip",
+	".zst": "zstd",
+	".bz2": "bzip2",
+	".xz":  "xz",
+	".7z":  "7z",
+}
+
+// formatExts are the extensions added to the individual files compressed by -format.
+var formatExts = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// FormatExt returns the extension added to the individual files compressed by format, or "" when
+// the format does not compress them.
+func FormatExt(format string) string {
+	return formatExts[format]
+}
+
+// compression returns the format of an already compressed source file, determined by its name
+// or its first bytes in head, or an empty string if the file is not compressed.
+func compression(name string, head []byte) string {
+	if format, ok := compressedExts[strings.ToLower(filepath.Ext(name))]; ok {
+		return format
+	}
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return "gzip"
+	case bytes.HasPrefix(head, magicZip):
+		return "zip"
+	case bytes.HasPrefix(head, magicZstd):
+		return "zstd"
+	case bytes.HasPrefix(head, magicBzip2):
+		return "bzip2"
+	case bytes.HasPrefix(head, magicXz):
+		return "xz"
+	}
+	return ""
+}
+
+// packSource decides whether the source file name of size bytes, read from src, is compressed
+// in the -format output. Already compressed files are stored as-is, unless -recompress is set
+// and they are gzipped, in which case the returned reader decompresses them. A file streamed to
+// Output is never compressed, but with Decompress a gzipped one is decompressed.
+func (r *run) packSource(srv *Server, src *bufio.Reader, name string, size int64, stream bool) (io.Reader, bool, error) {
+	if stream {
+		if head, _ := src.Peek(len(magicGzip)); !r.Decompress || !bytes.HasPrefix(head, magicGzip) {
+			return src, false, nil
+		}
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot decompress source file %q: %w", name, err)
+		}
+		return zr, false, nil
+	}
+	if !r.compress() {
+		return src, false, nil
+	}
+	if size < r.CompressMin {
+		r.logf("[debug][%s] copying %q uncompressed, it is smaller than -compress-min-size", srv.Name, FileName(name))
+		return src, false, nil
+	}
+	head, _ := src.Peek(len(magicXz))
+	format := compression(name, head)
+	if len(format) == 0 {
+		return src, true, nil
+	}
+	if !r.Recompress || !bytes.HasPrefix(head, magicGzip) {
+		r.logf("[info][%s] copying %q as-is, it is already %s compressed", srv.Name, FileName(name), format)
+		return src, false, nil
+	}
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot decompress source file %q: %w", name, err)
+	}
+	return zr, true, nil
+}
+
+// newCompressor returns a writer compressing to w in the -format output format, or passing the
+// data through unchanged when pack is not set. Closing it does not close w.
+func (r *run) newCompressor(w io.Writer, pack bool) io.WriteCloser {
+	if !pack {
+		return nopWriteCloser{w}
+	}
+	if r.Format == "zstd" {
+		level := zstd.SpeedDefault
+		if r.CompressLevel != gzip.DefaultCompression {
+			level = zstd.EncoderLevelFromZstd(r.CompressLevel)
+		}
+		zw, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+		return zw
+	}
+	zw, _ := gzip.NewWriterLevel(w, r.CompressLevel)
+	return zw
+}
+
+// NewDecompressor returns a reader decompressing r, the content of the file name compressed by
+// newCompressor. The format is determined by the extension of name.
+func NewDecompressor(name string, r io.Reader) (io.ReadCloser, error) {
+	if strings.EqualFold(filepath.Ext(name), formatExts["zstd"]) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return gzip.NewReader(r)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// ParseCompressLevel parses a compression level, given as 1 to 9 or as one of the names
+// BestSpeed, BestCompression and DefaultCompression (case-insensitive).
+func ParseCompressLevel(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "bestspeed":
+		return gzip.BestSpeed, nil
+	case "bestcompression":
+		return gzip.BestCompression, nil
+	case "", "defaultcompression":
+		return gzip.DefaultCompression, nil
+	}
+	level, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || level < gzip.BestSpeed || level > gzip.BestCompression {
+		return 0, fmt.Errorf("expected 1 to 9, BestSpeed, BestCompression or DefaultCompression, got %q", s)
+	}
+	return level, nil
+}
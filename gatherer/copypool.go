@@ -0,0 +1,45 @@
+package gatherer
+
+import (
+	"context"
+	"sync"
+)
+
+// copyPool runs the copies of the files of a single server, up to its files_parallel at the
+// same time. With one at a time, the copies run in the goroutine of the server itself.
+type copyPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newCopyPool(n int) *copyPool {
+	if n <= 1 {
+		return &copyPool{}
+	}
+	return &copyPool{slots: make(chan struct{}, n)}
+}
+
+// run runs copy once a slot of the pool is free. It does not run copy at all when ctx is done
+// first.
+func (p *copyPool) run(ctx context.Context, copy func()) {
+	if p.slots == nil {
+		copy()
+		return
+	}
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.slots }()
+		copy()
+	}()
+}
+
+// wait waits for all copies started by run to finish.
+func (p *copyPool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,16 @@
+package gatherer
+
+import (
+	"os"
+	"time"
+)
+
+// CreateTime returns the creation time of the file described by finfo. When the Sys value of
+// finfo has a CreateTime method, as for files on SMB shares, that time is returned, otherwise the
+// one the platform reports.
+func CreateTime(finfo os.FileInfo) time.Time {
+	if c, ok := finfo.Sys().(interface{ CreateTime() time.Time }); ok {
+		return c.CreateTime()
+	}
+	return osCreateTime(finfo)
+}
@@ -0,0 +1,16 @@
+package gatherer
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// osCreateTime returns the birth time of the file described by finfo, or its modification time
+// if that is not available.
+func osCreateTime(finfo os.FileInfo) time.Time {
+	if st, ok := finfo.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Birthtimespec.Unix())
+	}
+	return finfo.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux && !darwin
+
+package gatherer
+
+import (
+	"os"
+	"time"
+)
+
+// osCreateTime returns the modification time of the file described by finfo, as there is no
+// portable creation time on this platform.
+func osCreateTime(finfo os.FileInfo) time.Time {
+	return finfo.ModTime()
+}
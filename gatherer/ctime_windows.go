@@ -0,0 +1,16 @@
+package gatherer
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// osCreateTime returns the creation time of the file described by finfo, or its modification time
+// if that is not available.
+func osCreateTime(finfo os.FileInfo) time.Time {
+	if d, ok := finfo.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, d.CreationTime.Nanoseconds())
+	}
+	return finfo.ModTime()
+}
@@ -0,0 +1,70 @@
+package gatherer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobFolder is the folder of a window folder holding a single copy of each distinct file
+// gathered with -dedup. It is kept per window folder, so removing a window folder never breaks
+// the copies of another one.
+const blobFolder = ".blobs"
+
+// dedupCopy replaces the copy at target of srv, compressed when packed is set, by a hard link
+// to the blob with the same content, the decompressed SHA-256 sum. When there is no such blob
+// yet, the copy becomes it. The copy is kept as it is when the hard link fails, for example on
+// a file system without them. Linked copies share their modification time and permissions, so a
+// copy whose time or permissions differ from those of the blob is kept as well, which keeps
+// -skip-existing comparing it to its own source.
+func (r *run) dedupCopy(srv *Server, target string, packed bool, sum []byte) {
+	dir := fmt.Sprintf("%s/%s", srv.Cluster.Destination, blobFolder)
+	copyName := strings.TrimPrefix(target, srv.Cluster.Destination+"/")
+	if err := CreateFolder(dir, r.DirMode); err != nil {
+		r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		return
+	}
+	name := hex.EncodeToString(sum)
+	if packed {
+		// compressed and uncompressed copies of the same content differ
+		name += filepath.Ext(target)
+	}
+	blob := fmt.Sprintf("%s/%s", dir, name)
+
+	r.dedupMu.Lock()
+	defer r.dedupMu.Unlock()
+	binfo, err := os.Stat(blob)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.Link(target, blob); err != nil {
+			r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		}
+		return
+	} else if err != nil {
+		r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		return
+	}
+	tinfo, err := os.Stat(target)
+	if err != nil {
+		r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		return
+	}
+	if !tinfo.ModTime().Equal(binfo.ModTime()) || tinfo.Mode() != binfo.Mode() {
+		r.logf("[debug][%s] keeping %q, it is identical to an earlier copy but its modification time or permissions differ", srv.Name, FileName(copyName))
+		return
+	}
+	// the copy is only replaced once the link exists
+	tmp := target + ".dedup"
+	if err := os.Link(blob, tmp); err != nil {
+		r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		return
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		r.logf("[warning][%s] cannot deduplicate %q, keeping the copy: %v", srv.Name, FileName(copyName), err)
+		return
+	}
+	r.logf("[info][%s] %q is identical to an earlier copy, linked it to %s", srv.Name, FileName(copyName), FileName(fmt.Sprintf("%s/%s", blobFolder, name)))
+}
@@ -0,0 +1,62 @@
+package gatherer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	files := map[string]time.Duration{"a.tmp": 30 * time.Minute, "b.tmp": 20 * time.Minute}
+	data := map[string][]byte{"a.tmp": []byte("same"), "b.tmp": []byte("same")}
+	tests := []struct {
+		name   string
+		cfg    Config
+		blob   string // extension of the blobs
+		linked bool   // whether the copies of the two servers are linked
+	}{
+		{"identical", Config{}, "", true},
+		{"compressed", Config{Format: "gzip"}, ".gz", true},
+		// every copy gets its own modification time, which a link cannot keep
+		{"modification time differs", Config{MtimeFrom: "now"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, files, data)
+			// both servers read the same log share
+			cl.Servers = append(cl.Servers, &Server{Name: "web02", Host: cl.Servers[0].Host, Folder: "web02"})
+			cfg := tt.cfg
+			cfg.Clusters, cfg.Dedup = []*Cluster{cl}, true
+			if _, err := Gather(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			stat := func(name string) os.FileInfo {
+				t.Helper()
+				finfo, err := os.Stat(filepath.Join(cl.Destination, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return finfo
+			}
+			a1, a2 := stat("web01/a.tmp"+tt.blob), stat("web02/a.tmp"+tt.blob)
+			if got := os.SameFile(a1, a2); got != tt.linked {
+				t.Errorf("copies of a.tmp linked %t, want %t", got, tt.linked)
+			}
+			// a.tmp and b.tmp have the same content, but not the same modification time
+			if os.SameFile(a1, stat("web01/b.tmp"+tt.blob)) {
+				t.Errorf("a.tmp and b.tmp are linked, their modification times differ")
+			}
+			blobs, err := os.ReadDir(filepath.Join(cl.Destination, blobFolder))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, b := range blobs {
+				if filepath.Ext(b.Name()) != tt.blob {
+					t.Errorf("blob %s, want the extension %q", b.Name(), tt.blob)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package gatherer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows system error codes reported for a file held open or locked by another process.
+const (
+	errorSharingViolation = syscall.Errno(32)
+	errorLockViolation    = syscall.Errno(33)
+)
+
+// isSharingViolation reports whether err indicates that a file is held open or locked by
+// another process, usually the one writing it.
+func isSharingViolation(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
@@ -0,0 +1,34 @@
+package gatherer
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows system error codes reported for a full disk or an exceeded quota.
+const (
+	errorHandleDiskFull    = syscall.Errno(39)
+	errorDiskFull          = syscall.Errno(112)
+	errorDiskQuotaExceeded = syscall.Errno(1295)
+)
+
+// IsDiskFull reports whether err indicates that the destination is out of space or over quota.
+func IsDiskFull(err error) bool {
+	return errors.Is(err, errorHandleDiskFull) || errors.Is(err, errorDiskFull) || errors.Is(err, errorDiskQuotaExceeded)
+}
+
+// FreeSpace returns the number of bytes available to this process on the volume of path,
+// taking its quota into account.
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
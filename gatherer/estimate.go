@@ -0,0 +1,120 @@
+package gatherer
+
+import (
+	"context"
+	"sync"
+)
+
+// Estimate returns the number of bytes a gather with cfg is expected to write: the size of every
+// matching file, or every file listed in Paths, divided by CompressRatio when it is compressed.
+// The owners of the files are not checked and servers which cannot be reached count as nothing,
+// as gathering from them reports the errors.
+func Estimate(ctx context.Context, cfg Config) (int64, error) {
+	r, err := newRun(cfg)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		mu    sync.Mutex
+		total int64
+		wg    sync.WaitGroup
+	)
+	for _, cl := range r.Clusters {
+		for _, srv := range cl.Servers {
+			if r.Paths != nil && len(r.Paths[srv.Name]) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(srv *Server) {
+				defer wg.Done()
+				if !r.takeSlot(ctx) {
+					return
+				}
+				defer func() { <-r.slots }()
+				var n int64
+				for _, size := range r.matchingSizes(ctx, srv) {
+					if r.compress() && size >= r.CompressMin {
+						size = int64(float64(size) / r.CompressRatio)
+					}
+					n += size
+				}
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}(srv)
+		}
+	}
+	wg.Wait()
+	return total, nil
+}
+
+// matchingSizes returns the sizes of the files to gather from srv: the matching files of its log
+// shares, only the newest ones with Newest, or the files listed for it in Paths.
+func (r *run) matchingSizes(ctx context.Context, srv *Server) []int64 {
+	var listed map[string][]string
+	if r.Paths != nil {
+		listed = make(map[string][]string)
+		for _, p := range r.Paths[srv.Name] {
+			if logshare, rel, ok := srv.listedShare(p); ok {
+				listed[logshare] = append(listed[logshare], rel)
+			}
+		}
+	}
+	var sizes []int64
+	for _, logshare := range srv.Cluster.Shares {
+		if listed == nil || len(listed[logshare]) > 0 {
+			srv.logshare = logshare
+			sizes = append(sizes, r.shareSizes(ctx, srv, listed)...)
+		}
+	}
+	return sizes
+}
+
+// shareSizes returns the sizes of the files to gather from the log share srv.logshare, the
+// files listed for it in listed when that is not nil.
+func (r *run) shareSizes(ctx context.Context, srv *Server, listed map[string][]string) []int64 {
+	sh, err := openShare(ctx, srv)
+	if err != nil {
+		r.logf("[debug][%s] cannot connect to %q to estimate the size of the gather: %v", srv.Name, FileName(srv.src()), err)
+		return nil
+	}
+	srv.share = sh
+	defer func() {
+		sh.Close()
+		srv.share = nil
+	}()
+
+	var sizes []int64
+	if listed != nil {
+		for _, p := range listed[srv.logshare] {
+			if finfo, err := sh.Stat(p); err == nil && !finfo.IsDir() {
+				sizes = append(sizes, finfo.Size())
+			}
+		}
+		return sizes
+	}
+	files, err := r.walkSource(srv)
+	if err != nil {
+		r.logf("[debug][%s] cannot read %q to estimate the size of the gather: %v", srv.Name, FileName(srv.src()), err)
+		return nil
+	}
+	newest := newestSet{n: r.Newest}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		finfo, err := f.Info()
+		if err != nil || !ShouldCopy(finfo, srv.Cluster.Filter) {
+			continue
+		}
+		if r.Newest > 0 {
+			newest.add(sourceMatch{f, finfo})
+		} else {
+			sizes = append(sizes, finfo.Size())
+		}
+	}
+	for _, m := range newest.matches {
+		sizes = append(sizes, m.info.Size())
+	}
+	return sizes
+}
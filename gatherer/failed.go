@@ -0,0 +1,77 @@
+package gatherer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// FailedList is the name of the list in the window folder of a cluster of the files which could
+// not be read because access to them was denied, in the format of -files. -retry-failed copies
+// only these files.
+const FailedList = "failed.txt"
+
+// smbDenied are the NTSTATUS codes with which an SMB share denies access to a file: access
+// denied, a sharing violation and a conflicting lock.
+var smbDenied = map[uint32]bool{0xC0000022: true, 0xC0000043: true, 0xC0000054: true}
+
+// isDenied reports whether err indicates that access to a source file was denied, or that it is
+// held open by another process, which may well be over by a later run.
+func isDenied(err error) bool {
+	if errors.Is(err, os.ErrPermission) || isSharingViolation(err) {
+		return true
+	}
+	var rerr *smb2.ResponseError
+	return errors.As(err, &rerr) && smbDenied[rerr.Code]
+}
+
+// addFailed records the source file at p of srv, which is below the log share being gathered,
+// for the failed list of its cluster.
+func (r *run) addFailed(srv *Server, p string) {
+	line := fmt.Sprintf("%s:%s", srv.Name, path.Join(srv.shareFolder(srv.logshare), srv.rel(p)))
+	r.failedMu.Lock()
+	defer r.failedMu.Unlock()
+	r.failures[srv.Cluster.Name] = append(r.failures[srv.Cluster.Name], line)
+}
+
+// writeFailed writes the failed list of cl into its window folder, or removes the list of an
+// earlier run when no files were denied this time.
+func (r *run) writeFailed(cl *Cluster) {
+	r.failedMu.Lock()
+	lines := r.failures[cl.Name]
+	r.failedMu.Unlock()
+
+	name := fmt.Sprintf("%s/%s", cl.Destination, FailedList)
+	if len(lines) == 0 {
+		if err := os.Remove(name); err == nil {
+			r.logf("[info] removed %s, all files of cluster %q could be read", FileName(name), cl.Name)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			r.logf("[error] cannot remove %q: %v", FileName(name), err)
+		}
+		return
+	}
+	sort.Strings(lines)
+	if err := CreateFolder(cl.Destination, r.DirMode); err != nil {
+		r.logf("[error] cannot write %q: %v", FileName(name), err)
+		return
+	}
+	f, err := CreateFile(name, r.FileMode)
+	if err != nil {
+		r.logf("[error] cannot create %q: %v", FileName(name), err)
+		return
+	}
+	_, err = fmt.Fprintf(f, "# files of cluster %s which could not be read, copied again by -retry-failed\n%s\n", cl.Name, strings.Join(lines, "\n"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		r.logf("[error] cannot write %q: %v", FileName(name), err)
+		return
+	}
+	r.logf("[warning] recorded %d file(s) which could not be read in %s, copy them again with -retry-failed", len(lines), FileName(name))
+}
@@ -0,0 +1,107 @@
+package gatherer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestIsDenied(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"permission", &fs.PathError{Op: "open", Path: "a.tmp", Err: fs.ErrPermission}, true},
+		{"wrapped permission", fmt.Errorf("cannot open: %w", fs.ErrPermission), true},
+		{"smb access denied", &fs.PathError{Op: "open", Path: "a.tmp", Err: &smb2.ResponseError{Code: 0xC0000022}}, true},
+		{"smb sharing violation", &smb2.ResponseError{Code: 0xC0000043}, true},
+		{"smb file lock conflict", &smb2.ResponseError{Code: 0xC0000054}, true},
+		{"smb not found", &smb2.ResponseError{Code: 0xC0000034}, false},
+		{"not found", &fs.PathError{Op: "open", Path: "a.tmp", Err: fs.ErrNotExist}, false},
+		{"other", errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := isDenied(tt.err); got != tt.want {
+			t.Errorf("%s: isDenied(%v) = %t, want %t", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		shares []string
+		failed []string // logshare/path of the files which could not be read
+		want   []string // lines of the list, nil when there is none
+	}{
+		{"none", []string{"logs"}, nil, nil},
+		{"single share", []string{"logs"}, []string{"logs/b.tmp", "logs/sub/a.tmp"}, []string{"web01:b.tmp", "web01:sub/a.tmp"}},
+		{"several shares", []string{"logs", `iis\logs`}, []string{`iis\logs/a.tmp`, "logs/b.tmp"}, []string{"web01:iis/logs/a.tmp", "web01:logs/b.tmp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{Name: "web01", Host: "host"}
+			cl := &Cluster{Name: "web", Destination: filepath.ToSlash(t.TempDir()), Shares: tt.shares, Servers: []*Server{srv}}
+			name := filepath.Join(cl.Destination, FailedList)
+			// the list of an earlier run, which this one replaces or removes
+			if err := os.WriteFile(name, []byte("web01:old.tmp\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := newRun(Config{Clusters: []*Cluster{cl}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// recorded out of order, as the servers are gathered in parallel
+			for i := len(tt.failed) - 1; i >= 0; i-- {
+				logshare, rel, _ := strings.Cut(tt.failed[i], "/")
+				srv.logshare = logshare
+				r.addFailed(srv, srv.src()+"/"+rel)
+			}
+			r.writeFailed(cl)
+
+			data, err := os.ReadFile(name)
+			if tt.want == nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s is still there: %v", FailedList, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if !strings.HasPrefix(lines[0], "# ") {
+				t.Errorf("first line %q, want a comment", lines[0])
+			}
+			if !reflect.DeepEqual(lines[1:], tt.want) {
+				t.Errorf("%s lists %q, want %q", FailedList, lines[1:], tt.want)
+			}
+		})
+	}
+}
+
+func TestGatherFailedList(t *testing.T) {
+	cl := testCluster(t, map[string]time.Duration{"a.tmp": 30 * time.Minute, "b.tmp": 20 * time.Minute, "c.tmp": 10 * time.Minute}, nil)
+	// the lines of a failed list, as the cmd package reads them for -retry-failed
+	paths := map[string][]string{"web01": {"b.tmp", "missing.tmp"}}
+	stats, err := Gather(context.Background(), Config{Clusters: []*Cluster{cl}, Paths: paths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := windowFiles(t, cl), []string{"web01/b.tmp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gathered %q, want only the listed %q", got, want)
+	}
+	if tot := stats.Totals(); tot.Copied != 1 || tot.Errors != 1 {
+		t.Errorf("copied %d file(s) with %d error(s), want 1 and 1", tot.Copied, tot.Errors)
+	}
+}
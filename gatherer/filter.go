@@ -0,0 +1,171 @@
+// Package gatherer gathers the log files of the servers of clusters into their window folders,
+// with the settings of a Config, and holds the decisions of loggatherer that do not depend on the
+// ini file: which source files belong to a period, where their copies go and which period folders
+// have expired. Parsing the flags and the ini file, and reporting the result, is left to the
+// command.
+package gatherer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter holds the settings that decide which source files of a cluster are gathered.
+type Filter struct {
+	Start, End  time.Time     // period to gather, in the time of this machine
+	Grace       time.Duration // also gather files up to this long after End
+	ClockOffset time.Duration // how far the clocks of the servers run ahead of this machine
+	TimeField   string        // mtime, ctime or overlap, see InWindow
+	Suffixes    []string      // lower case name suffixes to gather
+	Include     []string      // glob patterns of the names to gather, all when empty
+	Exclude     []string      // glob patterns of the names never to gather
+	MinSize     int64
+	MaxSize     int64 // 0 means no limit
+	SkipEmpty   bool
+	AnyTime     bool // gather files of any time, the period only names the window folder
+}
+
+// ShouldCopy reports whether the source file described by info belongs to the period of f,
+// including the grace period, unless AnyTime is set, and passes its name and size filters.
+func ShouldCopy(info os.FileInfo, f Filter) bool {
+	from, to := f.period()
+	return (f.AnyTime || InWindow(CreateTime(info), info.ModTime(), from, to.Add(f.Grace), f.TimeField)) &&
+		f.hasSuffix(info.Name()) && f.nameMatches(info.Name()) && f.sizeMatches(info.Size())
+}
+
+// InGrace reports whether the source file described by info only belongs to the period of f
+// because of its grace period.
+func InGrace(info os.FileInfo, f Filter) bool {
+	from, to := f.period()
+	fCreate, fMod := CreateTime(info), info.ModTime()
+	return !f.AnyTime && InWindow(fCreate, fMod, from, to.Add(f.Grace), f.TimeField) && !InWindow(fCreate, fMod, from, to, f.TimeField)
+}
+
+// period returns the period of f in the time of the servers.
+func (f Filter) period() (from, to time.Time) {
+	return f.Start.Add(f.ClockOffset), f.End.Add(f.ClockOffset)
+}
+
+// InWindow reports whether a file created at fCreate and last modified at fMod belongs to the
+// period [from, to], including both ends, according to field:
+//
+//   - mtime: the file was last modified within the period
+//   - ctime: the file was created within the period
+//   - overlap: the file was written to during the period, that is it was created at or before
+//     its end and last modified at or after its start
+//
+// Files copied on Windows can have a creation time after their modification time, overlap then
+// uses the earlier of the two as the start of the activity.
+func InWindow(fCreate, fMod, from, to time.Time, field string) bool {
+	within := func(t time.Time) bool { return !t.Before(from) && !t.After(to) }
+	switch field {
+	case "mtime":
+		return within(fMod)
+	case "ctime":
+		return within(fCreate)
+	}
+	first, last := fCreate, fMod
+	if first.After(last) {
+		first, last = last, first
+	}
+	return !first.After(to) && !last.Before(from)
+}
+
+// hasSuffix reports whether name ends in one of the suffixes of f, ignoring case.
+func (f Filter) hasSuffix(name string) bool {
+	name = strings.ToLower(name)
+	for _, sfx := range f.Suffixes {
+		if strings.HasSuffix(name, sfx) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePatterns returns the comma-separated glob patterns of list. Patterns are lower case on
+// Windows, where names are matched case-insensitively.
+func ParsePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); len(p) == 0 {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		if runtime.GOOS == "windows" {
+			p = strings.ToLower(p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// nameMatches reports whether the base name matches one of the include patterns of f, if
+// any, and none of its exclude patterns.
+func (f Filter) nameMatches(name string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToLower(name)
+	}
+	for _, p := range f.Exclude {
+		if ok, _ := filepath.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, p := range f.Include {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeUnits are the multipliers of the units accepted by ParseSize.
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"tb", 1 << 40},
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// ParseSize parses a size in bytes with an optional B, KB, MB, GB or TB unit (case-insensitive,
+// multiples of 1024), such as 512, 10MB or 1.5GB. An empty string is a size of 0.
+func ParseSize(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if len(v) == 0 {
+		return 0, nil
+	}
+	n := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, n = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.n
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes with an optional B, KB, MB, GB or TB unit", s)
+	}
+	return int64(f * float64(n)), nil
+}
+
+// sizeMatches reports whether a file of size bytes is within the size limits of f, and not
+// empty if f skips empty files.
+func (f Filter) sizeMatches(size int64) bool {
+	if f.SkipEmpty && size == 0 {
+		return false
+	}
+	return size >= f.MinSize && (f.MaxSize == 0 || size <= f.MaxSize)
+}
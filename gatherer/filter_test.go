@@ -0,0 +1,135 @@
+package gatherer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInWindow(t *testing.T) {
+	from := time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+	at := func(d time.Duration) time.Time { return from.Add(d) }
+
+	tests := []struct {
+		name         string
+		create, mod  time.Time
+		mtime, ctime bool
+		overlap      bool
+	}{
+		{"before the period", at(-3 * time.Hour), at(-time.Hour), false, false, false},
+		{"after the period", at(3 * time.Hour), at(4 * time.Hour), false, false, false},
+		{"inside the period", at(time.Hour), at(90 * time.Minute), true, true, true},
+		{"straddling the start", at(-time.Hour), at(time.Hour), true, false, true},
+		{"straddling the end", at(time.Hour), at(3 * time.Hour), false, true, true},
+		{"spanning the period", at(-time.Hour), at(3 * time.Hour), false, false, true},
+		{"modified at the start", at(-time.Hour), from, true, false, true},
+		{"created at the end", to, at(3 * time.Hour), false, true, true},
+		{"modified just before the start", at(-time.Hour), at(-time.Nanosecond), false, false, false},
+		{"created just after the end", to.Add(time.Nanosecond), at(3 * time.Hour), false, false, false},
+		{"created after modified", at(3 * time.Hour), at(time.Hour), true, false, true},
+	}
+	for _, tt := range tests {
+		for field, want := range map[string]bool{"mtime": tt.mtime, "ctime": tt.ctime, "overlap": tt.overlap} {
+			if got := InWindow(tt.create, tt.mod, from, to, field); got != want {
+				t.Errorf("%s with -time-field %s: got %v, want %v", tt.name, field, got, want)
+			}
+		}
+	}
+}
+
+func TestShouldCopy(t *testing.T) {
+	start := time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)
+	base := Filter{Start: start, End: start.Add(2 * time.Hour), TimeField: "mtime", Suffixes: []string{".tmp"}}
+
+	tests := []struct {
+		name    string
+		file    string
+		size    int
+		mod     time.Time
+		cfg     func(*Filter)
+		want    bool
+		inGrace bool
+	}{
+		{"inside the period", "a.tmp", 10, start.Add(time.Hour), nil, true, false},
+		{"before the period", "a.tmp", 10, start.Add(-time.Hour), nil, false, false},
+		{"after the period", "a.tmp", 10, start.Add(3 * time.Hour), nil, false, false},
+		{"other suffix", "a.log", 10, start.Add(time.Hour), nil, false, false},
+		{"suffix in upper case", "A.TMP", 10, start.Add(time.Hour), nil, true, false},
+		{"within the grace period", "a.tmp", 10, start.Add(150 * time.Minute), func(c *Filter) { c.Grace = time.Hour }, true, true},
+		{"after the grace period", "a.tmp", 10, start.Add(4 * time.Hour), func(c *Filter) { c.Grace = time.Hour }, false, false},
+		{"server clock ahead", "a.tmp", 10, start.Add(150 * time.Minute), func(c *Filter) { c.ClockOffset = time.Hour }, true, false},
+		{"server clock behind", "a.tmp", 10, start.Add(90 * time.Minute), func(c *Filter) { c.ClockOffset = -time.Hour }, false, false},
+		{"included", "app.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.Include = []string{"app*"} }, true, false},
+		{"not included", "web.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.Include = []string{"app*"} }, false, false},
+		{"excluded", "app.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.Exclude = []string{"a?p.*"} }, false, false},
+		{"empty", "a.tmp", 0, start.Add(time.Hour), func(c *Filter) { c.SkipEmpty = true }, false, false},
+		{"below the minimum size", "a.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.MinSize = 11 }, false, false},
+		{"above the maximum size", "a.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.MaxSize = 9 }, false, false},
+		{"at the size limits", "a.tmp", 10, start.Add(time.Hour), func(c *Filter) { c.MinSize, c.MaxSize = 10, 10 }, true, false},
+		{"any time", "a.tmp", 10, start.Add(-24 * time.Hour), func(c *Filter) { c.AnyTime = true }, true, false},
+		{"any time, grace period", "a.tmp", 10, start.Add(150 * time.Minute), func(c *Filter) { c.AnyTime, c.Grace = true, time.Hour }, true, false},
+		{"any time, other suffix", "a.log", 10, start.Add(-24 * time.Hour), func(c *Filter) { c.AnyTime = true }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, make([]byte, tt.size), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, tt.mod, tt.mod); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := base
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			if got := ShouldCopy(info, cfg); got != tt.want {
+				t.Errorf("ShouldCopy: got %v, want %v", got, tt.want)
+			}
+			if got := InGrace(info, cfg); got != tt.inGrace {
+				t.Errorf("InGrace: got %v, want %v", got, tt.inGrace)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"", 0, false},
+		{"512", 512, false},
+		{"512b", 512, false},
+		{"1KB", 1 << 10, false},
+		{"10 mb", 10 << 20, false},
+		{"1.5GB", 3 << 29, false},
+		{"2tb", 2 << 40, false},
+		{"-1", 0, true},
+		{"ten", 0, true},
+		{"10PB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	got, err := ParsePatterns(" app*.tmp, ,web?.tmp ")
+	if err != nil || len(got) != 2 || got[0] != "app*.tmp" || got[1] != "web?.tmp" {
+		t.Errorf("ParsePatterns = %q, %v", got, err)
+	}
+	if _, err := ParsePatterns("[a"); err == nil {
+		t.Error("ParsePatterns accepted a bad pattern")
+	}
+}
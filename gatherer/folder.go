@@ -0,0 +1,187 @@
+package gatherer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultFolderFormat is the folder format of the period folders when none is configured, such
+// as 20230201T100000Z-20230201T120000Z.
+const DefaultFolderFormat = "{start:20060102T150405Z}-{end:20060102T150405Z}"
+
+// periodLayout is the time layout of {start} and {end} without one.
+const periodLayout = "20060102T150405Z"
+
+// formatField matches the fields of a folder format.
+var formatField = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+// FolderFormat is a template for the names of period folders. Its {start:layout} and
+// {end:layout} fields are replaced by the start and end of the period in UTC, formatted with the
+// Go time layout, and {cluster} by the name of the cluster. The rest of the template is kept as
+// is. When the layout of {end} has no date, the end is on the day of the start, or the next day
+// if that is before the start.
+type FolderFormat struct {
+	template string
+	parts    []formatPart
+	re       *regexp.Regexp // matches the names, with a group per field
+}
+
+// formatPart is a literal or a field of a folder format.
+type formatPart struct {
+	literal string
+	field   string // start, end or cluster, empty for a literal
+	layout  string
+}
+
+// ParseFolderFormat parses template as a folder format. It must have a {start} and an {end} field
+// and produce names which are valid folder names and can be parsed back.
+func ParseFolderFormat(template string) (*FolderFormat, error) {
+	f := &FolderFormat{template: template}
+	fields := make(map[string]int)
+	last := 0
+	for _, m := range formatField.FindAllStringSubmatchIndex(template, -1) {
+		if m[0] > last {
+			f.parts = append(f.parts, formatPart{literal: template[last:m[0]]})
+		}
+		p := formatPart{field: template[m[2]:m[3]]}
+		switch p.field {
+		case "start", "end":
+			p.layout = periodLayout
+			if m[4] >= 0 {
+				p.layout = template[m[4]:m[5]]
+			}
+		case "cluster":
+			if m[4] >= 0 {
+				return nil, fmt.Errorf("invalid folder format %q: {cluster} takes no layout", template)
+			}
+		default:
+			return nil, fmt.Errorf("invalid folder format %q: unknown field {%s}", template, p.field)
+		}
+		fields[p.field]++
+		f.parts = append(f.parts, p)
+		last = m[1]
+	}
+	if last < len(template) {
+		f.parts = append(f.parts, formatPart{literal: template[last:]})
+	}
+	if fields["start"] != 1 || fields["end"] != 1 {
+		return nil, fmt.Errorf("invalid folder format %q: expected one {start} and one {end} field", template)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, p := range f.parts {
+		switch p.field {
+		case "start", "end":
+			expr.WriteString("(" + layoutPattern(p.layout) + ")")
+		case "cluster":
+			expr.WriteString("(.+?)")
+		default:
+			expr.WriteString(regexp.QuoteMeta(p.literal))
+		}
+	}
+	expr.WriteString("$")
+	var err error
+	if f.re, err = regexp.Compile(expr.String()); err != nil {
+		return nil, fmt.Errorf("invalid folder format %q: %w", template, err)
+	}
+
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	name := f.Name("cluster", start, start.Add(time.Hour))
+	if strings.ContainsAny(name, `/\:*?"<>|`) {
+		return nil, fmt.Errorf("invalid folder format %q: %q is not a valid folder name", template, name)
+	}
+	if _, _, ok := f.Parse("cluster", name); !ok {
+		return nil, fmt.Errorf("invalid folder format %q: folder names such as %q cannot be parsed back", template, name)
+	}
+	return f, nil
+}
+
+// String returns the template of the folder format.
+func (f *FolderFormat) String() string {
+	return f.template
+}
+
+// Name returns the name of the folder of cluster for the period from start to end.
+func (f *FolderFormat) Name(cluster string, start, end time.Time) string {
+	var b strings.Builder
+	for _, p := range f.parts {
+		switch p.field {
+		case "start":
+			b.WriteString(start.UTC().Format(p.layout))
+		case "end":
+			b.WriteString(end.UTC().Format(p.layout))
+		case "cluster":
+			b.WriteString(cluster)
+		default:
+			b.WriteString(p.literal)
+		}
+	}
+	return b.String()
+}
+
+// Parse returns the start and end of the period of a folder of cluster named by Name. It reports
+// false for other names.
+func (f *FolderFormat) Parse(cluster, name string) (start, end time.Time, ok bool) {
+	m := f.re.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	i := 1
+	for _, p := range f.parts {
+		switch p.field {
+		case "start", "end":
+			t, err := time.Parse(p.layout, m[i])
+			if err != nil {
+				return time.Time{}, time.Time{}, false
+			}
+			if p.field == "start" {
+				start = t
+			} else {
+				end = t
+			}
+		case "cluster":
+			if m[i] != cluster {
+				return time.Time{}, time.Time{}, false
+			}
+		default:
+			continue
+		}
+		i++
+	}
+	if end.Year() == 0 {
+		end = time.Date(start.Year(), start.Month(), start.Day(), end.Hour(), end.Minute(), end.Second(), end.Nanosecond(), time.UTC)
+		if end.Before(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+	}
+	return start, end, true
+}
+
+// layoutPattern returns a regular expression matching the times formatted with layout: runs of
+// digits and of letters of a formatted time may have any length, the rest is kept as is.
+func layoutPattern(layout string) string {
+	sample := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout)
+	var expr strings.Builder
+	for i := 0; i < len(sample); {
+		j := i + 1
+		switch c := sample[i]; {
+		case c >= '0' && c <= '9', c == ' ':
+			for j < len(sample) && (sample[j] >= '0' && sample[j] <= '9' || sample[j] == ' ') {
+				j++
+			}
+			expr.WriteString(`[0-9 ]+`)
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+			for j < len(sample) && (sample[j] >= 'A' && sample[j] <= 'Z' || sample[j] >= 'a' && sample[j] <= 'z') {
+				j++
+			}
+			expr.WriteString(`[A-Za-z]+`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(sample[i:j]))
+		}
+		i = j
+	}
+	return expr.String()
+}
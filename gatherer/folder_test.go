@@ -0,0 +1,90 @@
+package gatherer
+
+import (
+	"testing"
+	"time"
+)
+
+func defaultFormat(t *testing.T) *FolderFormat {
+	f, err := ParseFolderFormat(DefaultFolderFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFolderFormat(t *testing.T) {
+	start := time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC)
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		format    string
+		end       time.Time
+		name      string
+		wantStart time.Time // parsed start and end, at the precision of the format
+		wantEnd   time.Time
+	}{
+		{DefaultFolderFormat, start.Add(time.Hour), "20240601T130000Z-20240601T140000Z", start, start.Add(time.Hour)},
+		{"{start}-{end}", start.Add(time.Hour), "20240601T130000Z-20240601T140000Z", start, start.Add(time.Hour)},
+		{"{start:2006-01-02_15.04}_to_{end:15.04}", start.Add(time.Hour), "2024-06-01_13.00_to_14.00", start, start.Add(time.Hour)},
+		{"{start:2006-01-02_15.04}_to_{end:15.04}", start.Add(12 * time.Hour), "2024-06-01_13.00_to_01.00", start, start.Add(12 * time.Hour)},
+		{"{cluster}_{start:2006-01-02}-{end:2006-01-02}", start.Add(48 * time.Hour), "c1_2024-06-01-2024-06-03", at(2024, 6, 1, 0), at(2024, 6, 3, 0)},
+		{"{start:Jan 2 15h}-{end:Jan 2 15h}", start.Add(time.Hour), "Jun 1 13h-Jun 1 14h", at(0, 6, 1, 13), at(0, 6, 1, 14)},
+	}
+	for _, tt := range tests {
+		f, err := ParseFolderFormat(tt.format)
+		if err != nil {
+			t.Errorf("ParseFolderFormat(%q): %v", tt.format, err)
+			continue
+		}
+		if name := f.Name("c1", start, tt.end); name != tt.name {
+			t.Errorf("%q: Name = %q, want %q", tt.format, name, tt.name)
+		}
+		if s, e, ok := f.Parse("c1", tt.name); !ok || !s.Equal(tt.wantStart) || !e.Equal(tt.wantEnd) {
+			t.Errorf("%q: Parse(%q) = %s, %s, %v, want %s, %s", tt.format, tt.name, s, e, ok, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestFolderFormatParseOther(t *testing.T) {
+	f := defaultFormat(t)
+	for _, name := range []string{
+		"",
+		"web01",
+		"20230201T100000Z",
+		"20230201T100000Z_20230201T120000Z",
+		"20230201T100000Z-20230201T120000",
+		"20230201T100000Z-2023020XT120000Z",
+		"20230201T100000Z-20230201T120000Z-1",
+		"20230201T100000Z-20230201T120000Z.old",
+		"2023-02-01",
+	} {
+		if _, _, ok := f.Parse("c1", name); ok {
+			t.Errorf("Parse(%q) accepted the name", name)
+		}
+	}
+
+	f, err := ParseFolderFormat("{cluster}-{start}-{end}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := f.Parse("c1", "c2-20230201T100000Z-20230201T120000Z"); ok {
+		t.Error("Parse accepted the folder of another cluster")
+	}
+}
+
+func TestParseFolderFormatInvalid(t *testing.T) {
+	for _, format := range []string{
+		"",
+		"{start}",
+		"{end}",
+		"{start}-{start}-{end}",
+		"{start}-{end}-{server}",
+		"{cluster:x}-{start}-{end}",
+		"{start:15:04}-{end:15:04}",
+		"{start:2006/01/02}-{end:2006/01/02}",
+	} {
+		if _, err := ParseFolderFormat(format); err == nil {
+			t.Errorf("ParseFolderFormat(%q) accepted the format", format)
+		}
+	}
+}
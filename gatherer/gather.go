@@ -0,0 +1,1083 @@
+package gatherer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the settings of a single gather by Gather. The zero values of the settings with
+// named options are their defaults.
+type Config struct {
+	Clusters []*Cluster
+	// Paths are the paths to copy per server of the only cluster, regardless of its period,
+	// instead of its matching files. Nil gathers the matching files.
+	Paths map[string][]string
+	// Output is written the newest matching file of the only server of the only cluster,
+	// instead of gathering into the destination, when it is not nil.
+	Output     io.Writer
+	Decompress bool // decompress the file written to Output when it is gzip compressed
+
+	Format        string // none, gzip or zstd for the individual files, or zip or tar.gz
+	CompressLevel int    // a level of compress/gzip
+	CompressMin   int64  // files smaller than this are copied uncompressed
+	Recompress    bool   // compress gzipped sources again instead of copying them as-is
+	Combine       bool   // write the lines of the text logs of a server to one .ndjson file
+	CombineMax    int64  // size in bytes above which files are copied instead of combined
+
+	DryRun     bool   // only log what would be copied
+	ListOnly   bool   // write a listing of the matching files per server instead
+	ListFormat string // csv or json
+	Manifest   string // none, csv or json
+
+	Newest        int  // only gather the newest files of each log share, all when 0
+	Recursive     bool // also gather the files in the subfolders of the log shares
+	FollowLinks   bool // gather the targets of links instead of skipping them
+	MtimeFrom     string
+	NoClobber     bool   // never overwrite a copy which is newer than its source
+	SkipExisting  bool   // skip the files copied before, as decided by SkipMode
+	SkipMode      string // mtime or hash
+	OnExists      string // overwrite, skip or rename
+	Purge         bool   // delete each source once its copy is verified
+	PurgeMinAge   time.Duration
+	Dedup         bool // hard link identical copies of a window folder to a single blob
+	PreserveOwner bool
+	DirMode       os.FileMode // permissions of the folders created, 0755 when 0
+	FileMode      os.FileMode // permissions of the files created, 0644 when 0
+
+	Parallel      int // number of servers gathered from at the same time, 1 when 0
+	Retries       int // number of times opening and reading a source are retried
+	RetryDelay    time.Duration
+	RetryOn       []*regexp.Regexp // retry the errors with a matching message, even permanent ones
+	NoRetryOn     []*regexp.Regexp // never retry the errors with a matching message
+	RateLimit     int64            // total bytes per second read from all servers, 0 means no limit
+	FailFast      bool             // stop the whole gather at the first error
+	Timeout       time.Duration
+	ServerTimeout time.Duration // abandon the remaining files of a server after this long
+	Progress      time.Duration // log the progress of a copy this often, never when 0
+	TraceIO       bool          // log the duration of the I/O phases of every copy
+	// Deterministic gathers one server and one file at a time, both in sorted order, and sets
+	// the copies MtimeFrom now to the end of the period of their cluster, so repeated gathers
+	// of the same sources write the same output and log the same messages. It disables all
+	// concurrency, Parallel and the files_parallel of the clusters, so it is meant for tests.
+	Deterministic bool
+
+	// CompressRatio is what the size of a compressed copy is expected to be divided by, for
+	// Estimate, 4 when 0.
+	CompressRatio float64
+	// Pause is called before every file is copied, it blocks for as long as the gather is
+	// paused. It may be nil.
+	Pause func()
+	// Logf logs the messages of the gather, which start with a [level] or [level][server]
+	// prefix. File arguments have the type FileName. It may be nil.
+	Logf func(format string, args ...interface{})
+}
+
+// FileName marks a logged argument as the name or path of a file.
+type FileName string
+
+// run is the state of a single Gather or Estimate.
+type run struct {
+	Config
+	cancel    context.CancelFunc // stops the gather, for FailFast
+	deadline  time.Time          // of the context of the gather, zero without one
+	slots     chan struct{}      // one for each of the Parallel servers
+	rateLimit *rateLimiter       // nil without RateLimit
+
+	destFull int32 // set once the destination ran out of space
+	failed   int32 // set once FailFast stopped the gather
+
+	statsMu    sync.Mutex
+	stats      map[statsKey]*ServerStats
+	timedOutMu sync.Mutex
+	timedOut   []string
+	manifestMu sync.Mutex
+	manifests  map[string][]ManifestEntry
+	failedMu   sync.Mutex
+	failures   map[string][]string // server:path lines by cluster
+	dedupMu    sync.Mutex          // so two identical copies made at the same time cannot both become the blob
+	previousMu sync.Mutex
+	previous   map[string]map[string]ManifestEntry // by cluster, then server and source path
+	digestMu   sync.Mutex
+	digests    map[string][]byte // SHA-256 of the sources read by sourceDigest, by path
+}
+
+// newRun returns the state of a gather with the settings of cfg, after filling in their defaults
+// and checking them.
+func newRun(cfg Config) (*run, error) {
+	defaults := []struct {
+		value *string
+		def   string
+	}{
+		{&cfg.Format, "none"},
+		{&cfg.ListFormat, "csv"},
+		{&cfg.Manifest, "none"},
+		{&cfg.MtimeFrom, "source-mtime"},
+		{&cfg.SkipMode, "mtime"},
+		{&cfg.OnExists, "overwrite"},
+	}
+	for _, d := range defaults {
+		if len(*d.value) == 0 {
+			*d.value = d.def
+		}
+	}
+	if cfg.DirMode == 0 {
+		cfg.DirMode = 0755
+	}
+	if cfg.FileMode == 0 {
+		cfg.FileMode = 0644
+	}
+	if cfg.Parallel < 1 {
+		cfg.Parallel = 1
+	}
+	if cfg.CompressRatio <= 0 {
+		cfg.CompressRatio = 4
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+
+	r := &run{
+		Config:    cfg,
+		slots:     make(chan struct{}, cfg.Parallel),
+		rateLimit: newRateLimiter(cfg.RateLimit),
+		stats:     make(map[statsKey]*ServerStats),
+		manifests: make(map[string][]ManifestEntry),
+		failures:  make(map[string][]string),
+		previous:  make(map[string]map[string]ManifestEntry),
+		digests:   make(map[string][]byte),
+	}
+	for _, cl := range cfg.Clusters {
+		for _, srv := range cl.Servers {
+			srv.Cluster = cl
+			srv.logshare = cl.Shares[0]
+			srv.limit = newRateLimiter(cl.ServerRateLimit)
+		}
+	}
+	return r, nil
+}
+
+// check returns an error when the settings of cfg, with their defaults filled in, cannot be
+// gathered with.
+func (cfg *Config) check() error {
+	oneOf := func(what, value string, values ...string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid %s %q, expected %s", what, value, strings.Join(values, ", "))
+	}
+	for _, err := range []error{
+		oneOf("format", cfg.Format, "none", "gzip", "zstd", "zip", "tar.gz"),
+		oneOf("list format", cfg.ListFormat, "csv", "json"),
+		oneOf("manifest format", cfg.Manifest, "none", "csv", "json"),
+		oneOf("modification time", cfg.MtimeFrom, "source-mtime", "source-ctime", "now"),
+		oneOf("skip mode", cfg.SkipMode, "mtime", "hash"),
+		oneOf("existing copy action", cfg.OnExists, "overwrite", "skip", "rename"),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case len(cfg.Clusters) == 0:
+		return errors.New("no cluster to gather")
+	case cfg.Paths != nil && len(cfg.Clusters) > 1:
+		return errors.New("listed paths can only be copied from a single cluster")
+	case cfg.Output != nil && (len(cfg.Clusters) > 1 || len(cfg.Clusters[0].Servers) != 1):
+		return errors.New("the output can only be written from a single server")
+	case cfg.Output != nil && (cfg.Paths != nil || cfg.DryRun || cfg.ListOnly):
+		return errors.New("the output cannot be written with listed paths, a dry run or a listing")
+	case cfg.archiveFormat() && (cfg.Purge || cfg.Dedup):
+		return fmt.Errorf("format %s cannot be combined with purging or deduplicating the copies", cfg.Format)
+	case cfg.SkipExisting && cfg.SkipMode == "hash" && cfg.Manifest == "none":
+		return errors.New("skip mode hash needs a manifest to record the digests of the copies")
+	}
+	for _, cl := range cfg.Clusters {
+		if len(cl.Shares) == 0 {
+			return fmt.Errorf("no log share for cluster %q", cl.Name)
+		}
+	}
+	return nil
+}
+
+// compress reports whether the copies, or the entries of the archives, are compressed.
+func (cfg *Config) compress() bool {
+	return cfg.Format != "none"
+}
+
+// archiveFormat reports whether the format writes an archive per server.
+func (cfg *Config) archiveFormat() bool {
+	return cfg.Format == "zip" || cfg.Format == "tar.gz"
+}
+
+// logf logs a message with the Logf of the gather, if any.
+func (r *run) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+// Gather gathers the files of the servers of the clusters of cfg into their window folders and
+// writes their manifests and failed lists, or writes the newest matching file to cfg.Output. It
+// returns the statistics of the gather, which stops early once ctx is done. Problems with
+// servers and files are logged and counted; only settings which cannot be gathered with are
+// returned as error, without gathering anything.
+func Gather(ctx context.Context, cfg Config) (Stats, error) {
+	r, err := newRun(cfg)
+	if err != nil {
+		return Stats{}, err
+	}
+	r.deadline, _ = ctx.Deadline()
+	ctx, r.cancel = context.WithCancel(ctx)
+	defer r.cancel()
+
+	if r.Output != nil {
+		// streaming writes nothing to the destination, so there are no manifests
+		r.streamNewest(ctx, r.Clusters[0].Servers[0], r.Output)
+		return r.statistics(), nil
+	}
+	var wg sync.WaitGroup
+	if r.Paths != nil {
+		for _, srv := range r.servers() {
+			if len(r.Paths[srv.Name]) > 0 {
+				wg.Add(1)
+				if r.Deterministic {
+					r.copyList(ctx, srv, r.Paths[srv.Name], &wg)
+				} else {
+					go r.copyList(ctx, srv, r.Paths[srv.Name], &wg)
+				}
+			}
+		}
+	} else {
+		for _, srv := range r.servers() {
+			wg.Add(1)
+			if r.Deterministic {
+				r.copyFiles(ctx, srv, &wg)
+			} else {
+				go r.copyFiles(ctx, srv, &wg)
+			}
+		}
+	}
+	wg.Wait()
+	if r.Manifest != "none" && !r.DryRun && !r.ListOnly {
+		for _, cl := range r.Clusters {
+			r.writeManifest(cl)
+		}
+	}
+	if !r.DryRun && !r.ListOnly {
+		for _, cl := range r.Clusters {
+			r.writeFailed(cl)
+		}
+	}
+	return r.statistics(), nil
+}
+
+// copyFiles gathers the matching files of the log shares of srv.
+func (r *run) copyFiles(ctx context.Context, srv *Server, w *sync.WaitGroup) {
+	defer w.Done()
+	if !r.takeSlot(ctx) {
+		r.serverStopped(ctx, srv)
+		return
+	}
+	defer func() { <-r.slots }()
+	if r.ServerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.ServerTimeout)
+		defer cancel()
+	}
+	dst := srv.Cluster.Destination
+	listPath := fmt.Sprintf("%s/%s", dst, r.listingName(srv.Folder))
+	if !r.ListOnly {
+		dst = fmt.Sprintf("%s/%s", dst, srv.Folder)
+	}
+	if !r.DryRun {
+		// with -format zip or tar.gz only the archive next to the server folder is written
+		folder := dst
+		if r.archiveFormat() {
+			folder = srv.Cluster.Destination
+		}
+		if !r.serverFolder(srv, folder) {
+			return
+		}
+	}
+
+	var comb *combiner
+	if r.Combine && !r.ListOnly && !r.DryRun {
+		comb = r.newCombiner(srv, fmt.Sprintf("%s.ndjson", dst))
+		defer comb.close()
+	}
+	var arc archive
+	if r.archiveFormat() && !r.ListOnly && !r.DryRun {
+		arc = r.newArchive(srv, dst)
+		defer arc.close()
+	}
+
+	g := &serverGather{run: r, srv: srv, dst: dst, comb: comb, arc: arc, copies: newCopyPool(r.filesParallel(srv))}
+	for _, logshare := range srv.Cluster.Shares {
+		if atomic.LoadInt32(&r.destFull) == 1 || r.serverStopped(ctx, srv) {
+			break
+		}
+		srv.logshare = logshare
+		g.gather(ctx)
+	}
+	if r.DryRun {
+		r.logf("[info][%s] would copy %d file(s), %d bytes in total", srv.Name, g.dryFiles, g.dryBytes)
+	} else if r.ListOnly {
+		r.writeListing(srv, listPath, g.listing)
+	}
+	if g.foreign > 0 {
+		r.logf("[info][%s] skipped %d file(s) not owned by an allowed owner", srv.Name, g.foreign)
+	}
+	r.logf("[info] done scanning %s", srv.Name)
+}
+
+// serverGather is the gather of the log shares of a single server by copyFiles.
+type serverGather struct {
+	run    *run
+	srv    *Server
+	dst    string // folder of the server, or the window folder with -list
+	comb   *combiner
+	arc    archive
+	copies *copyPool // the files added to an archive are always written one at a time
+
+	listing  []listEntry
+	foreign  int
+	dryFiles int
+	dryBytes int64
+}
+
+// gather gathers the matching files of the log share srv.logshare of the server. With more than
+// one share, its files are copied into a folder of their own below the one of the server.
+func (g *serverGather) gather(ctx context.Context) {
+	r, srv := g.run, g.srv
+	src, folder := srv.src(), srv.shareFolder(srv.logshare)
+	dst := g.dst
+	if len(folder) > 0 && !r.ListOnly {
+		dst = fmt.Sprintf("%s/%s", dst, folder)
+		if !r.DryRun && !r.archiveFormat() && !r.serverFolder(srv, dst) {
+			return
+		}
+	}
+	r.logf("[info] scanning %s", FileName(src))
+	if !r.connectShare(ctx, srv) {
+		return
+	}
+	defer srv.share.Close()
+	matches, foreign, ok := r.matchSources(ctx, srv)
+	g.foreign += foreign
+	if !ok {
+		return
+	}
+
+	for _, m := range matches {
+		r.pause()
+		if atomic.LoadInt32(&r.destFull) == 1 || r.serverStopped(ctx, srv) {
+			break
+		}
+		f, finfo := m.file, m.info
+		fMod := finfo.ModTime()
+		fCreate := CreateTime(finfo)
+		r.countMatched(srv)
+		if InGrace(finfo, srv.Cluster.Filter) {
+			r.logf("[info][%s] including %q (created %s, modified %s) within the grace period", srv.Name, FileName(f.rel), fCreate.UTC().Format("2006-01-02 15:04:05"), fMod.UTC().Format("2006-01-02 15:04:05"))
+		}
+		if r.DryRun {
+			r.logf("[info][%s] would copy %q (%d bytes, modified %s)", srv.Name, FileName(f.rel), finfo.Size(), fMod.UTC().Format("2006-01-02 15:04:05"))
+			g.dryFiles++
+			g.dryBytes += finfo.Size()
+			continue
+		}
+		if r.ListOnly {
+			g.listing = append(g.listing, listEntry{Name: path.Join(folder, f.rel), Size: finfo.Size(), ModTime: fMod, CreateTime: fCreate})
+			continue
+		}
+		if g.comb != nil && g.comb.add(ctx, fmt.Sprintf("%s/%s", src, f.rel), finfo) {
+			continue
+		}
+		if g.arc != nil {
+			g.arc.add(ctx, fmt.Sprintf("%s/%s", src, f.rel), path.Join(folder, f.rel), finfo)
+			continue
+		}
+		dir, ok := r.fileFolder(srv, dst, f.rel)
+		if !ok {
+			continue
+		}
+		source := fmt.Sprintf("%s/%s", src, f.rel)
+		g.copies.run(ctx, func() { r.gatherFile(ctx, srv, source, dir, finfo, nil) })
+	}
+	g.copies.wait()
+}
+
+// servers returns the servers of the clusters of the gather, sorted by cluster and server with
+// Deterministic.
+func (r *run) servers() []*Server {
+	var servers []*Server
+	for _, cl := range r.Clusters {
+		servers = append(servers, cl.Servers...)
+	}
+	if r.Deterministic {
+		sort.Slice(servers, func(i, j int) bool {
+			if servers[i].Cluster.Name != servers[j].Cluster.Name {
+				return servers[i].Cluster.Name < servers[j].Cluster.Name
+			}
+			return servers[i].Name < servers[j].Name
+		})
+	}
+	return servers
+}
+
+// filesParallel returns the number of files of srv copied at the same time.
+func (r *run) filesParallel(srv *Server) int {
+	if r.Deterministic {
+		return 1
+	}
+	return srv.Cluster.Parallel
+}
+
+// pause blocks for as long as the gather is paused.
+func (r *run) pause() {
+	if r.Pause != nil {
+		r.Pause()
+	}
+}
+
+// matchSources returns the files of the log share srv.logshare of the server, which srv.share
+// is connected to, that pass the filters of its cluster, and the number of matching files skipped
+// for their owner. It returns false when the share cannot be read, which is logged and counted.
+func (r *run) matchSources(ctx context.Context, srv *Server) ([]sourceMatch, int, bool) {
+	src := srv.src()
+	var sdir []sourceFile
+	err := r.retry(ctx, srv, fmt.Sprintf("reading %q", src), func() (err error) {
+		sdir, err = r.scanSource(srv)
+		return err
+	})
+	if err != nil {
+		r.logf("[error][%s] unable to open %q: %v", srv.Name, FileName(src), err)
+		r.countError(srv)
+		return nil, 0, false
+	}
+
+	var (
+		matches []sourceMatch
+		newest  = newestSet{n: r.Newest}
+		foreign int
+	)
+	filter := srv.Cluster.Filter
+	for _, f := range sdir {
+		if f.IsDir() {
+			continue
+		}
+		finfo, err := f.Info()
+		if err != nil {
+			r.logf("[error][%s] cannot read file info for %q: %v", srv.Name, FileName(f.rel), err)
+			r.countError(srv)
+			continue
+		}
+		r.logf("[debug][%s] checking %s (m=%s | c=%s)...", srv.Name, FileName(f.rel), finfo.ModTime().Format("2006-01-02 15:04:05"), CreateTime(finfo).Format("2006-01-02 15:04:05"))
+		if !ShouldCopy(finfo, filter) {
+			r.logf("[debug][%s] skipping %s: outside the period or not matching the name and size filters", srv.Name, FileName(f.rel))
+			continue
+		}
+		r.logf("[debug][%s] file %s is between %q and %q", srv.Name, FileName(f.rel), filter.Start.Format("2006-01-02 15:04:05"), filter.End.Format("2006-01-02 15:04:05"))
+		if len(srv.Cluster.Owners) > 0 {
+			owner, err := srv.share.Owner(f.rel, finfo)
+			if err != nil {
+				r.logf("[error][%s] skipping %q: cannot read owner: %v", srv.Name, FileName(f.rel), err)
+				r.countError(srv)
+				continue
+			}
+			if !srv.Cluster.Owners[strings.ToUpper(owner)] {
+				foreign++
+				continue
+			}
+		}
+		if r.Newest > 0 {
+			newest.add(sourceMatch{f, finfo})
+			continue
+		}
+		matches = append(matches, sourceMatch{f, finfo})
+	}
+	if r.Newest > 0 {
+		if newest.added > r.Newest {
+			r.logf("[info][%s] gathering the newest %d of %d matching file(s)", srv.Name, r.Newest, newest.added)
+		}
+		// newest first, and in the same order on every run
+		return newest.sorted(), foreign, true
+	}
+	if r.Deterministic {
+		sort.Slice(matches, func(i, j int) bool { return matches[i].file.rel < matches[j].file.rel })
+	}
+	return matches, foreign, true
+}
+
+// copyList copies the given paths, relative to the log share, of a single server to dst
+// regardless of the time window. With more than one log share, the paths start with the folder
+// of their share, see listedShare.
+func (r *run) copyList(ctx context.Context, srv *Server, paths []string, w *sync.WaitGroup) {
+	defer w.Done()
+	if !r.takeSlot(ctx) {
+		r.serverStopped(ctx, srv)
+		return
+	}
+	defer func() { <-r.slots }()
+	if r.ServerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.ServerTimeout)
+		defer cancel()
+	}
+	dst := fmt.Sprintf("%s/%s", srv.Cluster.Destination, srv.Folder)
+	r.logf("[info] copying %d listed file(s) from %s", len(paths), srv.Name)
+
+	if !r.DryRun {
+		// with -format zip or tar.gz only the archive next to the server folder is written
+		folder := dst
+		if r.archiveFormat() {
+			folder = srv.Cluster.Destination
+		}
+		if !r.serverFolder(srv, folder) {
+			return
+		}
+	}
+	var arc archive
+	if r.archiveFormat() && !r.DryRun {
+		arc = r.newArchive(srv, dst)
+		defer arc.close()
+	}
+
+	listed := make(map[string][]string)
+	for _, p := range paths {
+		logshare, rel, ok := srv.listedShare(p)
+		if !ok {
+			r.logf("[error][%s] cannot copy %q: it does not start with the folder of one of the log shares", srv.Name, FileName(p))
+			r.countMatched(srv)
+			r.countError(srv)
+			continue
+		}
+		listed[logshare] = append(listed[logshare], rel)
+	}
+	if r.Deterministic {
+		for _, rels := range listed {
+			sort.Strings(rels)
+		}
+	}
+	// the files added to an archive are always written one at a time by this goroutine
+	copies := newCopyPool(r.filesParallel(srv))
+	var (
+		dryFiles int
+		dryBytes int64
+	)
+	for _, logshare := range srv.Cluster.Shares {
+		if len(listed[logshare]) == 0 {
+			continue
+		}
+		if atomic.LoadInt32(&r.destFull) == 1 || r.serverStopped(ctx, srv) {
+			break
+		}
+		srv.logshare = logshare
+		src, folder := srv.src(), srv.shareFolder(logshare)
+		sdst := dst
+		if len(folder) > 0 {
+			sdst = fmt.Sprintf("%s/%s", dst, folder)
+			if !r.DryRun && !r.archiveFormat() && !r.serverFolder(srv, sdst) {
+				continue
+			}
+		}
+		if !r.connectShare(ctx, srv) {
+			continue
+		}
+		for _, p := range listed[logshare] {
+			r.pause()
+			if atomic.LoadInt32(&r.destFull) == 1 || r.serverStopped(ctx, srv) {
+				break
+			}
+			r.countMatched(srv)
+			finfo, err := srv.share.Stat(p)
+			if err != nil {
+				r.logf("[error][%s] cannot read file info for %q: %v", srv.Name, FileName(p), err)
+				r.countError(srv)
+				continue
+			}
+			if finfo.IsDir() {
+				r.logf("[error][%s] cannot copy %q: is a directory", srv.Name, FileName(p))
+				r.countError(srv)
+				continue
+			}
+			if r.DryRun {
+				r.logf("[info][%s] would copy %q (%d bytes, modified %s)", srv.Name, FileName(p), finfo.Size(), finfo.ModTime().UTC().Format("2006-01-02 15:04:05"))
+				dryFiles++
+				dryBytes += finfo.Size()
+				continue
+			}
+			if arc != nil {
+				arc.add(ctx, fmt.Sprintf("%s/%s", src, p), path.Join(folder, p), finfo)
+				continue
+			}
+			dir, ok := r.fileFolder(srv, sdst, p)
+			if !ok {
+				continue
+			}
+			source := fmt.Sprintf("%s/%s", src, p)
+			copies.run(ctx, func() { r.gatherFile(ctx, srv, source, dir, finfo, nil) })
+		}
+		// the copies need the share until they are done
+		copies.wait()
+		srv.share.Close()
+	}
+	if r.DryRun {
+		r.logf("[info][%s] would copy %d file(s), %d bytes in total", srv.Name, dryFiles, dryBytes)
+	}
+	r.logf("[info] done copying %s", srv.Name)
+}
+
+// streamNewest writes the content of the most recently modified matching file of the log
+// shares of srv to w, through the copy path of gatherFile. Nothing is written to the
+// destination.
+func (r *run) streamNewest(ctx context.Context, srv *Server, w io.Writer) {
+	var (
+		newestFile  sourceMatch
+		newestShare string
+	)
+	for _, logshare := range srv.Cluster.Shares {
+		srv.logshare = logshare
+		if !r.connectShare(ctx, srv) {
+			continue
+		}
+		matches, _, ok := r.matchSources(ctx, srv)
+		srv.share.Close()
+		if !ok || len(matches) == 0 {
+			continue
+		}
+		if m := newestMatches(matches, 1)[0]; len(newestShare) == 0 || m.info.ModTime().After(newestFile.info.ModTime()) {
+			newestFile, newestShare = m, logshare
+		}
+	}
+	if len(newestShare) == 0 {
+		r.logf("[warning][%s] no matching file to stream", srv.Name)
+		return
+	}
+
+	srv.logshare = newestShare
+	if !r.connectShare(ctx, srv) {
+		return
+	}
+	defer srv.share.Close()
+	r.countMatched(srv)
+	path, finfo := fmt.Sprintf("%s/%s", srv.src(), newestFile.file.rel), newestFile.info
+	r.logf("[info][%s] streaming %q (%d bytes, modified %s) to the output", srv.Name, FileName(path), finfo.Size(), finfo.ModTime().UTC().Format("2006-01-02 15:04:05"))
+	r.gatherFile(ctx, srv, path, "", finfo, w)
+}
+
+// connectShare connects to the log share of srv, which is retried. It returns false when the
+// share cannot be reached, which is logged and counted.
+func (r *run) connectShare(ctx context.Context, srv *Server) bool {
+	err := r.retry(ctx, srv, fmt.Sprintf("connecting to %q", srv.src()), func() (err error) {
+		srv.share, err = openShare(ctx, srv)
+		return err
+	})
+	if err != nil {
+		r.logf("[error][%s] unable to connect to %q: %v", srv.Name, FileName(srv.src()), err)
+		r.countError(srv)
+		return false
+	}
+	return true
+}
+
+// takeSlot waits for one of the Parallel slots to become free. It returns false, without
+// taking a slot, when ctx is done first.
+func (r *run) takeSlot(ctx context.Context) bool {
+	select {
+	case r.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CreateFolder makes sure the destination folder dst exists, creating it with the permissions
+// mode when it does not.
+func CreateFolder(dst string, mode os.FileMode) error {
+	_, err := os.Stat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := MkdirAll(dst, mode); err != nil {
+			return fmt.Errorf("cannot create destination folder %q: %w", dst, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open destination folder %q: %w", dst, err)
+	}
+	return nil
+}
+
+// serverFolder makes sure the destination folder dst of srv exists. A folder which cannot be
+// created is logged and counted, the gather goes on with the other servers unless the
+// destination is full.
+func (r *run) serverFolder(srv *Server, dst string) bool {
+	if err := CreateFolder(dst, r.DirMode); err != nil {
+		r.logf("[error][%s] %v", srv.Name, err)
+		r.countError(srv)
+		if IsDiskFull(err) {
+			r.markDestinationFull(srv.Name, err)
+		}
+		return false
+	}
+	return true
+}
+
+// fileFolder returns the folder below dst to copy the file at the relative path rel of the log
+// share of srv to, so that the folder structure of the share is kept. The folder is created when
+// needed, with the permissions of the folders of the share. It returns false when the folder
+// cannot be created, which is logged and counted.
+func (r *run) fileFolder(srv *Server, dst, rel string) (string, bool) {
+	folder := FileFolder(dst, rel)
+	if folder == dst {
+		return dst, true
+	}
+	if _, err := os.Stat(folder); err == nil {
+		return folder, true
+	}
+	if !r.serverFolder(srv, folder) {
+		return "", false
+	}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if finfo, err := srv.share.Stat(dir); err == nil {
+			r.copyMode(srv, fmt.Sprintf("%s/%s", dst, dir), finfo)
+		}
+	}
+	return folder, true
+}
+
+// gatherFile copies the source file at path into the dst folder and sets the modification
+// time of the copy to the one of the source, or writes it to w instead when w is not nil.
+// Opening and reading the source are retried. A source to which access is still denied after
+// that is recorded for the failed list.
+func (r *run) gatherFile(ctx context.Context, srv *Server, path, dst string, finfo os.FileInfo, w io.Writer) {
+	err := r.retry(ctx, srv, fmt.Sprintf("copying %q", finfo.Name()), func() error {
+		return r.tryGatherFile(ctx, srv, path, dst, finfo, w)
+	})
+	if err != nil {
+		r.logf("[error][%s] %v", srv.Name, err)
+		r.countError(srv)
+		if isDenied(err) {
+			r.addFailed(srv, path)
+		}
+	}
+}
+
+// tryGatherFile makes a single attempt at gatherFile. It returns an error only when the source
+// could not be opened or read, all other failures are logged and counted here. Writing to w skips
+// everything which concerns the copy in the destination.
+func (r *run) tryGatherFile(ctx context.Context, srv *Server, path, dst string, finfo os.FileInfo, w io.Writer) error {
+	tr := r.newFileTrace()
+	s, err := srv.open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open source file %q: %w", finfo.Name(), err)
+	}
+	in := &countingReader{r: r.throttle(ctx, srv, s)}
+	src := bufio.NewReader(tr.reader(in))
+
+	targetName := finfo.Name()
+	rd, pack, err := r.packSource(srv, src, finfo.Name(), finfo.Size(), w != nil)
+	if err != nil {
+		r.logf("[error][%s] %v", srv.Name, err)
+		r.countError(srv)
+		s.Close()
+		return nil
+	}
+	_, recompressed := rd.(*gzip.Reader)
+	if recompressed {
+		// a recompressed x.gz is written as x plus the extension of the output format
+		if strings.EqualFold(filepath.Ext(targetName), ".gz") {
+			targetName = targetName[:len(targetName)-3]
+		}
+		targetName += formatExts[r.Format]
+	} else if pack {
+		targetName += formatExts[r.Format]
+	}
+	fMod := finfo.ModTime()
+
+	mtime := r.targetModTime(srv, finfo)
+	var (
+		zd      *os.File
+		renamed string
+	)
+	if w == nil {
+		// the manifest of a recompressed source holds the digest of its decompressed content
+		if r.SkipExisting && r.SkipMode == "hash" && !recompressed {
+			if r.skipUnchanged(ctx, srv, path, finfo) {
+				r.countSkipped(srv)
+				s.Close()
+				return nil
+			}
+		} else if r.SkipExisting && r.SkipMode == "mtime" {
+			// the size of a compressed copy differs from the source, so only its time is compared
+			if dinfo, err := os.Stat(fmt.Sprintf("%s/%s", dst, targetName)); err == nil && dinfo.ModTime().Equal(mtime) && (pack || dinfo.Size() == finfo.Size()) {
+				r.logf("[info][%s] skipping %q: destination already exists", srv.Name, FileName(targetName))
+				r.countSkipped(srv)
+				r.keepPrevious(srv, path, finfo)
+				s.Close()
+				return nil
+			}
+		}
+		if r.NoClobber {
+			if dinfo, err := os.Stat(fmt.Sprintf("%s/%s", dst, targetName)); err == nil && dinfo.ModTime().After(fMod) {
+				r.logf("[warning][%s] skipping %q: destination is newer than source (%s > %s)", srv.Name, FileName(targetName), dinfo.ModTime().Format("2006-01-02 15:04:05"), fMod.Format("2006-01-02 15:04:05"))
+				r.countSkipped(srv)
+				r.keepPrevious(srv, path, finfo)
+				s.Close()
+				return nil
+			}
+		}
+		if r.OnExists != "overwrite" {
+			if _, err := os.Lstat(fmt.Sprintf("%s/%s", dst, targetName)); err == nil {
+				if r.OnExists == "skip" {
+					r.logf("[info][%s] skipping %q: destination already exists (-on-exists skip)", srv.Name, FileName(targetName))
+					r.countSkipped(srv)
+					r.keepPrevious(srv, path, finfo)
+					s.Close()
+					return nil
+				}
+				renamed = strings.TrimPrefix(fmt.Sprintf("%s/%s", dst, targetName), srv.Cluster.Destination+"/")
+				newName := FreeName(dst, targetName)
+				r.logf("[info][%s] %q already exists, copying to %q instead", srv.Name, FileName(targetName), FileName(newName))
+				targetName = newName
+			}
+		}
+		// an existing copy may be read-only, or linked to the copies of other servers with -dedup
+		os.Remove(fmt.Sprintf("%s/%s", dst, targetName))
+		zd, err = CreateFile(fmt.Sprintf("%s/%s", dst, targetName), r.FileMode)
+		if err != nil {
+			r.logf("[error][%s] cannot open destination file %q: %v", srv.Name, FileName(targetName), err)
+			r.countError(srv)
+			s.Close()
+			if IsDiskFull(err) {
+				r.markDestinationFull(srv.Name, err)
+			}
+			return nil
+		}
+		w = zd
+	}
+	out := &countingWriter{w: w}
+	d := r.newCompressor(tr.writer(out), pack)
+	tr.opened()
+	var h hash.Hash
+	if zd != nil && (r.Purge || r.Dedup || r.Manifest != "none") {
+		h = sha256.New()
+		rd = io.TeeReader(rd, h)
+	}
+	if err := copyFile(ctx, rd, r.withProgress(d, srv, finfo.Name(), finfo.Size())); err != nil {
+		tr.copied()
+		s.Close()
+		d.Close()
+		if zd == nil {
+			// a partial stream cannot be retried, as its start was written already
+			r.logf("[error][%s] cannot stream %q: %v", srv.Name, FileName(path), err)
+			r.countError(srv)
+			return nil
+		}
+		zd.Close()
+		tr.closed()
+		tr.print(srv.Name, targetName)
+		// the partial copy would be newer than the source and stop -no-clobber-newer retries
+		os.Remove(fmt.Sprintf("%s/%s", dst, targetName))
+		if IsDiskFull(err) {
+			r.logf("[error][%s] cannot copy source to destination %q: %v", srv.Name, FileName(targetName), err)
+			r.countError(srv)
+			r.markDestinationFull(srv.Name, err)
+			return nil
+		}
+		if r.serverStopped(ctx, srv) {
+			r.logf("[warning][%s] stopped copying %q, the partial copy was removed", srv.Name, FileName(targetName))
+			return nil
+		}
+		return fmt.Errorf("cannot copy source to destination %q: %w", targetName, err)
+	}
+	tr.copied()
+	s.Close()
+	if zd == nil {
+		d.Close()
+		tr.closed()
+		tr.print(srv.Name, targetName)
+		r.countCopied(srv, in.n, out.n)
+		r.sourceChanged(srv, path, finfo, in.n)
+		return nil
+	}
+	err = closeCopy(d, zd)
+	tr.closed()
+	if err != nil {
+		tr.print(srv.Name, targetName)
+		// the copy is cut short, so it must not be listed, linked or replace its source
+		os.Remove(fmt.Sprintf("%s/%s", dst, targetName))
+		r.logf("[error][%s] cannot write destination file %q: %v", srv.Name, FileName(targetName), err)
+		r.countError(srv)
+		if IsDiskFull(err) {
+			r.markDestinationFull(srv.Name, err)
+		}
+		return nil
+	}
+	r.countCopied(srv, in.n, out.n)
+	if pack {
+		r.countCompressed(srv)
+	}
+	unstable := r.sourceChanged(srv, path, finfo, in.n)
+	var sum []byte
+	if h != nil {
+		sum = h.Sum(nil)
+	}
+	r.addManifest(srv, finfo, ManifestEntry{
+		Path:       path,
+		Copy:       strings.TrimPrefix(fmt.Sprintf("%s/%s", dst, targetName), srv.Cluster.Destination+"/"),
+		Compressed: pack,
+		SHA256:     hex.EncodeToString(sum),
+		Unstable:   unstable,
+		Renamed:    renamed,
+	})
+	r.logf("[debug][%s] setting last modified date on %s to %s...", srv.Name, FileName(targetName), mtime.Format("2006-01-02 15:04:05"))
+	if err := os.Chtimes(fmt.Sprintf("%s/%s", dst, targetName), time.Now(), mtime); err != nil {
+		r.logf("[error][%s] error setting last modified date on %s: %v", srv.Name, FileName(targetName), err)
+		r.countError(srv)
+	}
+	tr.timesSet()
+	tr.print(srv.Name, targetName)
+	r.copyMode(srv, fmt.Sprintf("%s/%s", dst, targetName), finfo)
+	if r.Dedup {
+		r.dedupCopy(srv, fmt.Sprintf("%s/%s", dst, targetName), pack, sum)
+	}
+
+	// a source which is still being written is never deleted
+	if r.Purge && !unstable {
+		r.purgeSource(srv, path, fmt.Sprintf("%s/%s", dst, targetName), pack, sum, fMod)
+	}
+	return nil
+}
+
+// closeCopy closes the compressor d of a copy and then its destination file f, and returns the
+// first error. The compressors write their last block when they are closed, and a local file
+// may only report that its volume is full on close, so a copy is only complete once both are.
+func closeCopy(d, f io.Closer) error {
+	err := d.Close()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sourceChanged reports whether the source file at path of srv changed while read bytes of it
+// were copied, as finfo describes it from before the copy. It logs a warning when it did, as the
+// copy may then be truncated or miss what was appended.
+func (r *run) sourceChanged(srv *Server, path string, finfo os.FileInfo, read int64) bool {
+	reason := ""
+	if read != finfo.Size() {
+		reason = fmt.Sprintf("%d bytes were read instead of %d", read, finfo.Size())
+	} else if now, err := srv.share.Stat(srv.rel(path)); err != nil {
+		reason = fmt.Sprintf("cannot check it again: %v", err)
+	} else if now.Size() != finfo.Size() {
+		reason = fmt.Sprintf("its size changed from %d to %d bytes", finfo.Size(), now.Size())
+	} else if !now.ModTime().Equal(finfo.ModTime()) {
+		reason = fmt.Sprintf("it was modified at %s", now.ModTime().UTC().Format("2006-01-02 15:04:05"))
+	}
+	if len(reason) == 0 {
+		return false
+	}
+	r.logf("[warning][%s] %q changed while it was copied, %s: the copy may be incomplete", srv.Name, FileName(finfo.Name()), reason)
+	r.countChanged(srv)
+	return true
+}
+
+// targetModTime returns the modification time to set on the copy of the source file finfo of
+// srv.
+func (r *run) targetModTime(srv *Server, finfo os.FileInfo) time.Time {
+	switch r.MtimeFrom {
+	case "source-ctime":
+		return CreateTime(finfo)
+	case "now":
+		if r.Deterministic {
+			return srv.Cluster.Filter.End
+		}
+		return time.Now()
+	}
+	return finfo.ModTime()
+}
+
+// serverStopped reports whether srv has to stop copying because the gather was interrupted or
+// the -timeout or its -server-timeout expired, in which case the server is recorded as timed out.
+func (r *run) serverStopped(ctx context.Context, srv *Server) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return true
+	}
+	name := fmt.Sprintf("%s/%s", srv.Cluster.Name, srv.Name)
+	r.timedOutMu.Lock()
+	defer r.timedOutMu.Unlock()
+	for _, n := range r.timedOut {
+		if n == name {
+			return true
+		}
+	}
+	if !r.deadline.IsZero() && !time.Now().Before(r.deadline) {
+		r.logf("[error][%s] run timeout of %s exceeded, skipping the remaining files", srv.Name, r.Timeout)
+	} else {
+		r.logf("[error][%s] server timeout of %s exceeded, skipping the remaining files", srv.Name, r.ServerTimeout)
+	}
+	r.timedOut = append(r.timedOut, name)
+	return true
+}
+
+// failRun stops the gather after the first error of srv with -fail-fast.
+func (r *run) failRun(srv *Server) {
+	if atomic.CompareAndSwapInt32(&r.failed, 0, 1) {
+		r.logf("[error][%s] stopping the gather at the first error (-fail-fast)", srv.Name)
+		if r.cancel != nil {
+			r.cancel()
+		}
+	}
+}
+
+// markDestinationFull records that the destination ran out of space, which stops
+// all servers from starting any further copies.
+func (r *run) markDestinationFull(server string, err error) {
+	if atomic.CompareAndSwapInt32(&r.destFull, 0, 1) {
+		r.logf("[error][%s] destination is full, no further files will be copied: %v", server, err)
+	}
+}
+
+// copyFile copies source to dest until ctx is done.
+func copyFile(ctx context.Context, source io.Reader, dest io.Writer) error {
+	_, err := io.Copy(dest, ctxReader{ctx, source})
+	return err
+}
+
+// ctxReader stops reading from r once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,306 @@
+package gatherer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCluster creates a log share holding files, which were last modified the given time ago,
+// and returns a cluster with a single server web01 gathering the last hour from it into a window
+// folder of its own.
+func testCluster(t *testing.T, files map[string]time.Duration, data map[string][]byte) *Cluster {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the log share is reached as //host/share, which needs a real share on Windows")
+	}
+	dir := t.TempDir()
+	for name, age := range files {
+		path := filepath.Join(dir, "logs", name)
+		content, ok := data[name]
+		if !ok {
+			content = []byte(name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// //tmp/x/logs is /tmp/x/logs, so the first folder of dir serves as the host
+	host, logshare, _ := strings.Cut(strings.TrimPrefix(filepath.ToSlash(dir), "/"), "/")
+	now := time.Now()
+	return &Cluster{
+		Name:        "web",
+		Destination: filepath.ToSlash(filepath.Join(t.TempDir(), "window")),
+		Shares:      []string{logshare + "/logs"},
+		Filter:      Filter{Start: now.Add(-time.Hour), End: now, TimeField: "mtime", Suffixes: []string{".tmp"}},
+		Servers:     []*Server{{Name: "web01", Host: host, Folder: "web01"}},
+		Parallel:    1,
+	}
+}
+
+// windowFiles returns the slash-separated paths of the files in and below the window folder of
+// cl, nil when it does not exist.
+func windowFiles(t *testing.T, cl *Cluster) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(cl.Destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(cl.Destination, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGather(t *testing.T) {
+	files := map[string]time.Duration{
+		"a.tmp":   30 * time.Minute,
+		"b.log":   30 * time.Minute, // another suffix
+		"old.tmp": 48 * time.Hour,   // before the period
+	}
+	tests := []struct {
+		name            string
+		cfg             Config
+		want            []string
+		matched, copied int
+	}{
+		{name: "copy", want: []string{"web01/a.tmp"}, matched: 1, copied: 1},
+		{name: "gzip", cfg: Config{Format: "gzip"}, want: []string{"web01/a.tmp.gz"}, matched: 1, copied: 1},
+		{name: "zstd", cfg: Config{Format: "zstd"}, want: []string{"web01/a.tmp.zst"}, matched: 1, copied: 1},
+		{name: "zip", cfg: Config{Format: "zip"}, want: []string{"web01.zip"}, matched: 1, copied: 1},
+		{name: "tar.gz", cfg: Config{Format: "tar.gz"}, want: []string{"web01.tar.gz"}, matched: 1, copied: 1},
+		{name: "manifest", cfg: Config{Manifest: "json"}, want: []string{"manifest.json", "web01/a.tmp"}, matched: 1, copied: 1},
+		{name: "dry run", cfg: Config{DryRun: true}, matched: 1},
+		{name: "list only", cfg: Config{ListOnly: true, ListFormat: "json"}, want: []string{"web01.json"}, matched: 1},
+		{name: "paths", cfg: Config{Paths: map[string][]string{"web01": {"old.tmp"}}}, want: []string{"web01/old.tmp"}, matched: 1, copied: 1},
+		{name: "missing path", cfg: Config{Paths: map[string][]string{"web01": {"gone.tmp"}}}, matched: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, files, nil)
+			cfg := tt.cfg
+			cfg.Clusters = []*Cluster{cl}
+			stats, err := Gather(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := windowFiles(t, cl); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("window folder holds %q, want %q", got, tt.want)
+			}
+			if tot := stats.Totals(); tot.Matched != tt.matched || tot.Copied != tt.copied {
+				t.Errorf("matched %d and copied %d file(s), want %d and %d", tot.Matched, tot.Copied, tt.matched, tt.copied)
+			}
+		})
+	}
+}
+
+func TestGatherOutput(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("newest"))
+	zw.Close()
+	files := map[string]time.Duration{"a.tmp": 30 * time.Minute, "b.tmp": 10 * time.Minute}
+	tests := []struct {
+		name       string
+		data       []byte
+		decompress bool
+		want       []byte
+	}{
+		{"plain", []byte("newest"), false, []byte("newest")},
+		{"gzipped", gz.Bytes(), false, gz.Bytes()},
+		{"decompressed", gz.Bytes(), true, []byte("newest")},
+		{"plain decompressed", []byte("newest"), true, []byte("newest")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, files, map[string][]byte{"b.tmp": tt.data})
+			var out bytes.Buffer
+			// the format of the copies does not apply to the output
+			stats, err := Gather(context.Background(), Config{Clusters: []*Cluster{cl}, Output: &out, Decompress: tt.decompress, Format: "gzip"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("output %q, want %q", out.Bytes(), tt.want)
+			}
+			if tot := stats.Totals(); tot.Matched != 1 || tot.Copied != 1 || tot.Errors != 0 {
+				t.Errorf("matched %d, copied %d and %d error(s), want 1 file copied without errors", tot.Matched, tot.Copied, tot.Errors)
+			}
+			if got := windowFiles(t, cl); got != nil {
+				t.Errorf("window folder holds %q, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestGatherConfig(t *testing.T) {
+	two := []*Cluster{{Name: "a", Shares: []string{"logs"}}, {Name: "b", Shares: []string{"logs"}}}
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no clusters", Config{}},
+		{"format", Config{Clusters: two[:1], Format: "rar"}},
+		{"paths of two clusters", Config{Clusters: two, Paths: map[string][]string{}}},
+		{"output of two clusters", Config{Clusters: two, Output: &bytes.Buffer{}}},
+		{"output of a dry run", Config{Clusters: []*Cluster{{Name: "a", Shares: []string{"logs"}, Servers: []*Server{{Name: "web01"}}}}, Output: &bytes.Buffer{}, DryRun: true}},
+		{"dedup into an archive", Config{Clusters: two[:1], Format: "zip", Dedup: true}},
+		{"skip by hash without manifest", Config{Clusters: two[:1], SkipExisting: true, SkipMode: "hash"}},
+		{"no share", Config{Clusters: []*Cluster{{Name: "a"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := Gather(context.Background(), tt.cfg); err == nil {
+			t.Errorf("%s: Gather succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestGatherDeterministic(t *testing.T) {
+	files := map[string]time.Duration{"c.tmp": 10 * time.Minute, "a.tmp": 30 * time.Minute, "sub/b.tmp": 20 * time.Minute}
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"copies", Config{Manifest: "json"}},
+		{"compressed", Config{Format: "gzip", MtimeFrom: "now", Manifest: "csv"}},
+		{"zip", Config{Format: "zip", MtimeFrom: "now", Manifest: "json"}},
+		{"tar.gz", Config{Format: "tar.gz", Manifest: "json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, files, nil)
+			cl.Parallel = 4
+			cl.Servers = append(cl.Servers, &Server{Name: "web02", Host: cl.Servers[0].Host, Folder: "web02"})
+			// two gathers of the same sources into window folders of their own
+			var outputs [2]map[string]string
+			var logs [2][]string
+			for i := range outputs {
+				cl.Destination = filepath.ToSlash(filepath.Join(t.TempDir(), "window"))
+				cfg := tt.cfg
+				cfg.Clusters, cfg.Recursive, cfg.Parallel, cfg.Deterministic = []*Cluster{cl}, true, 4, true
+				cfg.Logf = func(format string, args ...interface{}) {
+					logs[i] = append(logs[i], strings.ReplaceAll(fmt.Sprintf(format, args...), cl.Destination, "<window>"))
+				}
+				if _, err := Gather(context.Background(), cfg); err != nil {
+					t.Fatal(err)
+				}
+				outputs[i] = make(map[string]string)
+				for _, name := range windowFiles(t, cl) {
+					path := filepath.Join(cl.Destination, filepath.FromSlash(name))
+					data, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					outputs[i][name] = fmt.Sprintf("%x", data)
+					if !strings.Contains(name, "/") {
+						continue // a manifest or archive, written when the gather ends
+					}
+					finfo, err := os.Stat(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					outputs[i][name] += " " + finfo.ModTime().UTC().String()
+				}
+			}
+			if len(outputs[0]) == 0 || !reflect.DeepEqual(outputs[0], outputs[1]) {
+				t.Errorf("the gathers wrote\n%v\nand\n%v", outputs[0], outputs[1])
+			}
+			if !reflect.DeepEqual(logs[0], logs[1]) {
+				t.Errorf("the gathers logged\n%s\nand\n%s", strings.Join(logs[0], "\n"), strings.Join(logs[1], "\n"))
+			}
+		})
+	}
+}
+
+// failingWriter fails every write with err.
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+// closerFunc closes by calling itself.
+type closerFunc func() error
+
+func (c closerFunc) Close() error { return c() }
+
+func TestCloseCopy(t *testing.T) {
+	full := errors.New("no space left on device")
+	fine := closerFunc(func() error { return nil })
+	tests := []struct {
+		name   string
+		format string
+		w      io.Writer  // written to by the compressor
+		f      closerFunc // the destination file
+	}{
+		// the compressor only writes its buffered blocks on close
+		{"gzip flush", "gzip", failingWriter{full}, fine},
+		{"zstd flush", "zstd", failingWriter{full}, fine},
+		{"file close", "none", io.Discard, closerFunc(func() error { return full })},
+	}
+	for _, tt := range tests {
+		r, err := newRun(Config{Clusters: []*Cluster{{Name: "web", Shares: []string{"logs"}}}, Format: tt.format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := r.newCompressor(tt.w, tt.format != "none")
+		io.WriteString(d, "a line of the log\n")
+		if err := closeCopy(d, tt.f); !errors.Is(err, full) {
+			t.Errorf("%s: closeCopy = %v, want %v", tt.name, err, full)
+		}
+	}
+}
+
+func BenchmarkCopyFile(b *testing.B) {
+	dir := b.TempDir()
+	src := filepath.Join(dir, "source.tmp")
+	data := make([]byte, 64<<20)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := os.Open(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		d, err := os.Create(filepath.Join(dir, "dest.tmp"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := copyFile(context.Background(), s, d); err != nil {
+			b.Fatal(err)
+		}
+		s.Close()
+		d.Close()
+	}
+}
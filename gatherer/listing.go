@@ -0,0 +1,53 @@
+package gatherer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// listEntry is a single matched source file in the listing written by -list-only.
+type listEntry struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	CreateTime time.Time `json:"ctime"`
+}
+
+// writeListing writes the entries matched on srv to path in the -list-format format.
+func (r *run) writeListing(srv *Server, path string, entries []listEntry) {
+	f, err := CreateFile(path, r.FileMode)
+	if err != nil {
+		r.logf("[error][%s] cannot create listing %q: %v", srv.Name, FileName(path), err)
+		r.countError(srv)
+		return
+	}
+	defer f.Close()
+
+	if r.ListFormat == "json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	} else {
+		w := csv.NewWriter(f)
+		w.Write([]string{"name", "size", "mtime", "ctime"})
+		for _, e := range entries {
+			w.Write([]string{e.Name, strconv.FormatInt(e.Size, 10), e.ModTime.UTC().Format(time.RFC3339), e.CreateTime.UTC().Format(time.RFC3339)})
+		}
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		r.logf("[error][%s] cannot write listing %q: %v", srv.Name, FileName(path), err)
+		r.countError(srv)
+		return
+	}
+	r.logf("[info][%s] listed %d file(s) in %s", srv.Name, len(entries), FileName(path))
+}
+
+// listingName returns the name of the listing file for the destination folder of a server.
+func (r *run) listingName(folder string) string {
+	return fmt.Sprintf("%s.%s", folder, r.ListFormat)
+}
@@ -0,0 +1,148 @@
+package gatherer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ManifestEntry is a single gathered file in the manifest written by -manifest.
+type ManifestEntry struct {
+	Server     string    `json:"server"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	CreateTime time.Time `json:"ctime"`
+	Compressed bool      `json:"compressed"`
+	Copy       string    `json:"copy"`               // relative to the window folder, <folder>.zip:<name> or <folder>.tar.gz:<name> for archive entries
+	SHA256     string    `json:"sha256,omitempty"`   // of the (decompressed) copied data, not set for combined files
+	Unstable   bool      `json:"unstable,omitempty"` // the source changed while it was copied
+	Renamed    string    `json:"renamed,omitempty"`  // existing copy kept by -on-exists rename
+}
+
+// manifestHeader is the header row of manifest.csv.
+var manifestHeader = []string{"server", "path", "size", "mtime", "ctime", "compressed", "copy", "sha256", "unstable", "renamed"}
+
+// addManifest records the gathered file e, with the server and the size and times of the
+// source file described by finfo filled in. The copy of e is relative to the window folder.
+func (r *run) addManifest(srv *Server, finfo os.FileInfo, e ManifestEntry) {
+	if r.Manifest == "none" {
+		return
+	}
+	e.Server = srv.Name
+	e.Size = finfo.Size()
+	e.ModTime = finfo.ModTime()
+	e.CreateTime = CreateTime(finfo)
+	r.manifestMu.Lock()
+	defer r.manifestMu.Unlock()
+	r.manifests[srv.Cluster.Name] = append(r.manifests[srv.Cluster.Name], e)
+}
+
+// keepPrevious records the entry of the source file at path of srv in the manifest of an
+// earlier run again, for a file which is skipped because its copy is there already, so the
+// manifest of this run still lists that copy.
+func (r *run) keepPrevious(srv *Server, path string, finfo os.FileInfo) {
+	if r.Manifest == "none" {
+		return
+	}
+	if prev, ok := r.previousEntry(srv, path); ok {
+		r.addManifest(srv, finfo, prev)
+	}
+}
+
+// writeManifest writes the manifest of the files gathered for cl into its window folder, in the
+// -manifest format.
+func (r *run) writeManifest(cl *Cluster) {
+	r.manifestMu.Lock()
+	entries := r.manifests[cl.Name]
+	r.manifestMu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Server != entries[j].Server {
+			return entries[i].Server < entries[j].Server
+		}
+		return entries[i].Path < entries[j].Path
+	})
+
+	path := fmt.Sprintf("%s/manifest.%s", cl.Destination, r.Manifest)
+	if err := CreateFolder(cl.Destination, r.DirMode); err != nil {
+		r.logf("[error] cannot create manifest %q: %v", FileName(path), err)
+		return
+	}
+	f, err := CreateFile(path, r.FileMode)
+	if err != nil {
+		r.logf("[error] cannot create manifest %q: %v", FileName(path), err)
+		return
+	}
+	defer f.Close()
+
+	if r.Manifest == "json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	} else {
+		w := csv.NewWriter(f)
+		w.Write(manifestHeader)
+		for _, e := range entries {
+			w.Write([]string{e.Server, e.Path, strconv.FormatInt(e.Size, 10), e.ModTime.UTC().Format(time.RFC3339), e.CreateTime.UTC().Format(time.RFC3339), strconv.FormatBool(e.Compressed), e.Copy, e.SHA256, strconv.FormatBool(e.Unstable), e.Renamed})
+		}
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		r.logf("[error] cannot write manifest %q: %v", FileName(path), err)
+		return
+	}
+	r.logf("[info] recorded %d gathered file(s) in %s", len(entries), FileName(path))
+}
+
+// ReadManifest reads the manifest.json or manifest.csv in the window folder.
+func ReadManifest(folder string) ([]ManifestEntry, error) {
+	if data, err := os.ReadFile(fmt.Sprintf("%s/manifest.json", folder)); err == nil {
+		var entries []ManifestEntry
+		return entries, json.Unmarshal(data, &entries)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := os.Open(fmt.Sprintf("%s/manifest.csv", folder))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	if _, err := r.Read(); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	var entries []ManifestEntry
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// manifests of earlier versions lack the last columns
+		if len(rec) < 8 || len(rec) > len(manifestHeader) {
+			return nil, fmt.Errorf("expected %d fields, got %d: %q", len(manifestHeader), len(rec), rec)
+		}
+		e := ManifestEntry{Server: rec[0], Path: rec[1], Copy: rec[6], SHA256: rec[7]}
+		e.Size, _ = strconv.ParseInt(rec[2], 10, 64)
+		e.ModTime, _ = time.Parse(time.RFC3339, rec[3])
+		e.CreateTime, _ = time.Parse(time.RFC3339, rec[4])
+		e.Compressed, _ = strconv.ParseBool(rec[5])
+		if len(rec) > 8 {
+			e.Unstable, _ = strconv.ParseBool(rec[8])
+		}
+		if len(rec) > 9 {
+			e.Renamed = rec[9]
+		}
+		entries = append(entries, e)
+	}
+}
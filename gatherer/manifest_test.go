@@ -0,0 +1,59 @@
+package gatherer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManifestKeepsSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		touch bool // make the copy newer than its source before the second gather
+	}{
+		{"-skip-existing", Config{SkipExisting: true}, false},
+		{"-skip-mode hash", Config{SkipExisting: true, SkipMode: "hash"}, false},
+		{"-on-exists skip", Config{OnExists: "skip"}, false},
+		{"-no-clobber-newer", Config{NoClobber: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, map[string]time.Duration{"a.tmp": 30 * time.Minute}, nil)
+			cfg := tt.cfg
+			cfg.Clusters, cfg.Manifest = []*Cluster{cl}, "csv"
+			if _, err := Gather(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			first, err := ReadManifest(cl.Destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.touch {
+				now := time.Now()
+				if err := os.Chtimes(filepath.Join(cl.Destination, "web01", "a.tmp"), now, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the second gather of the window leaves the copy alone
+			stats, err := Gather(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tot := stats.Totals(); tot.Copied != 0 || tot.Skipped != 1 {
+				t.Errorf("copied %d and skipped %d file(s), want 0 and 1", tot.Copied, tot.Skipped)
+			}
+			second, err := ReadManifest(cl.Destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(first) != 1 || !reflect.DeepEqual(second, first) {
+				t.Errorf("manifest holds %+v after skipping, want %+v", second, first)
+			}
+		})
+	}
+}
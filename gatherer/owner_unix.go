@@ -0,0 +1,34 @@
+//go:build !windows
+
+package gatherer
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner returns the uid of the owner of the file described by finfo.
+func fileOwner(_ string, finfo os.FileInfo) (string, error) {
+	st, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", errors.New("no ownership information available")
+	}
+	return strconv.FormatUint(uint64(st.Uid), 10), nil
+}
+
+// CanChown reports whether this process may give files another owner, which needs root.
+func CanChown() bool {
+	return os.Geteuid() == 0
+}
+
+// copyOwner gives the file at path the uid and gid of the source described by finfo. Sources
+// without them, such as those of an SMB share, are left alone.
+func copyOwner(path string, finfo os.FileInfo) error {
+	st, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,32 @@
+package gatherer
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileOwner returns the SID of the owner of the file at path.
+func fileOwner(path string, _ os.FileInfo) (string, error) {
+	sd, err := windows.GetNamedSecurityInfo(filepath.FromSlash(path), windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION)
+	if err != nil {
+		return "", err
+	}
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return "", err
+	}
+	return owner.String(), nil
+}
+
+// CanChown reports whether this process may give files another owner, which it never does on
+// Windows.
+func CanChown() bool {
+	return false
+}
+
+// copyOwner does nothing on Windows, where -preserve-owner is ignored.
+func copyOwner(string, os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package gatherer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Destination returns the destination root dest, relative to dir unless it is an absolute path,
+// cleaned and with forward slashes. A UNC path such as \\server\share\logs on Windows becomes
+// //server/share/logs.
+func Destination(dest, dir string) string {
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(dir, dest)
+	}
+	return strings.ReplaceAll(filepath.Clean(dest), "\\", "/")
+}
+
+// FileFolder returns the folder below dst to copy the file at the relative path rel of a log
+// share to, so that the folder structure of the share is kept.
+func FileFolder(dst, rel string) string {
+	dir := filepath.ToSlash(filepath.Dir(rel))
+	if dir == "." {
+		return dst
+	}
+	return fmt.Sprintf("%s/%s", dst, dir)
+}
+
+// FreeName returns name, or when a file called name already exists in dir, the first name with a
+// numeric suffix before its extension which does not exist yet, such as a-1.tmp for a.tmp.
+func FreeName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i, n := 1, name; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, n)); os.IsNotExist(err) {
+			return n
+		}
+		n = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
@@ -0,0 +1,73 @@
+package gatherer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDestination(t *testing.T) {
+	abs, _ := filepath.Abs("logs")
+	tests := []struct {
+		dest, dir, want string
+	}{
+		{"logs", "/opt/loggatherer", "/opt/loggatherer/logs"},
+		{"logs", `C:\loggatherer`, "C:/loggatherer/logs"},
+		{abs, "/opt/loggatherer", filepath.ToSlash(abs)},
+		{"./logs/", "/opt/loggatherer/", "/opt/loggatherer/logs"},
+		{"old/../logs", "/opt/loggatherer", "/opt/loggatherer/logs"},
+		{"gathered logs", "/opt/log gatherer", "/opt/log gatherer/gathered logs"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []struct {
+			dest, dir, want string
+		}{
+			{`\\fs01\logs\gathered`, `C:\loggatherer`, "//fs01/logs/gathered"},
+			{`D:\logs/gathered\`, `C:\loggatherer`, "D:/logs/gathered"},
+			{`logs/gathered`, `\\fs01\tools\loggatherer`, "//fs01/tools/loggatherer/logs/gathered"},
+		}...)
+	}
+	for _, tt := range tests {
+		if got := Destination(tt.dest, tt.dir); got != tt.want {
+			t.Errorf("Destination(%q, %q) = %q, want %q", tt.dest, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestFileFolder(t *testing.T) {
+	tests := []struct {
+		rel, want string
+	}{
+		{"a.tmp", "out/web01"},
+		{"2023-02-01/a.tmp", "out/web01/2023-02-01"},
+		{filepath.Join("x", "y", "a.tmp"), "out/web01/x/y"},
+	}
+	for _, tt := range tests {
+		if got := FileFolder("out/web01", tt.rel); got != tt.want {
+			t.Errorf("FileFolder(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.tmp", "a-1.tmp", "b.tmp.gz", "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name, want string
+	}{
+		{"a.tmp", "a-2.tmp"},
+		{"b.tmp.gz", "b.tmp-1.gz"},
+		{"c", "c-1"},
+		{"d.tmp", "d.tmp"},
+	}
+	for _, tt := range tests {
+		if got := FreeName(dir, tt.name); got != tt.want {
+			t.Errorf("FreeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
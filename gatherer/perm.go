@@ -0,0 +1,80 @@
+package gatherer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ParseMode parses the octal permissions s, such as 0755, or returns def when s is empty.
+func ParseMode(s string, def os.FileMode) (os.FileMode, error) {
+	if s = strings.TrimSpace(s); len(s) == 0 {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permissions such as 0755", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// CreateFile creates or truncates the file at path, with the permissions mode regardless of the
+// umask.
+func CreateFile(path string, mode os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// MkdirAll creates the folder dir and the missing folders above it, with the permissions mode
+// regardless of the umask.
+func MkdirAll(dir string, mode os.FileMode) error {
+	var missing []string
+	for d := filepath.Clean(dir); d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMode gives the copy at path the permissions of the source described by finfo and, with
+// -preserve-owner, its owner. Folders keep all the permissions of their owner, so they can still
+// be filled and cleaned up. On Windows, where the permissions only hold the read-only attribute,
+// copies stay writable for the same reason. Failures are logged and counted.
+func (r *run) copyMode(srv *Server, path string, finfo os.FileInfo) {
+	if r.PreserveOwner {
+		if err := copyOwner(path, finfo); err != nil {
+			r.logf("[error][%s] cannot set the owner of %s: %v", srv.Name, FileName(path), err)
+			r.countError(srv)
+		}
+	}
+	mode := finfo.Mode().Perm()
+	if finfo.IsDir() {
+		mode |= 0700
+	} else if runtime.GOOS == "windows" {
+		mode |= 0200
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		r.logf("[error][%s] cannot set the permissions of %s: %v", srv.Name, FileName(path), err)
+		r.countError(srv)
+	}
+}
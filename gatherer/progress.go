@@ -0,0 +1,46 @@
+package gatherer
+
+import (
+	"io"
+	"time"
+)
+
+// progressWriter logs how far the copy of a file has got every -progress-interval, so a long
+// copy over a slow link can be told apart from a stuck one.
+type progressWriter struct {
+	run   *run
+	w     io.Writer
+	srv   *Server
+	name  string
+	size  int64 // of the source
+	n     int64 // bytes of the source written so far
+	start time.Time
+	last  time.Time
+	lastN int64
+}
+
+// withProgress returns w, wrapped in a progressWriter for the copy of the source file name of
+// the given size of srv when -progress-interval is set.
+func (r *run) withProgress(w io.Writer, srv *Server, name string, size int64) io.Writer {
+	if r.Progress <= 0 {
+		return w
+	}
+	now := time.Now()
+	return &progressWriter{run: r, w: w, srv: srv, name: name, size: size, start: now, last: now}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= p.run.Progress {
+		// the rate is that of the last interval, the percentage that of the whole file
+		rate := float64(p.n-p.lastN) / now.Sub(p.last).Seconds()
+		percent := 100.0
+		if p.size > 0 {
+			percent = float64(p.n) * 100 / float64(p.size)
+		}
+		p.run.logf("[info][%s] copying %q: %d of %d bytes (%.0f%%) after %s, %.0f bytes/s", p.srv.Name, FileName(p.name), p.n, p.size, percent, now.Sub(p.start).Round(time.Second), rate)
+		p.last, p.lastN = now, p.n
+	}
+	return n, err
+}
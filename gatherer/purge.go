@@ -0,0 +1,56 @@
+package gatherer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+// purgeSource removes the source file at path once the copy at target, which is compressed when
+// packed is set, is proven to hash to sum. Sources modified less than purgeMinAge ago are kept.
+func (r *run) purgeSource(srv *Server, path, target string, packed bool, sum []byte, fMod time.Time) {
+	if time.Since(fMod) < r.PurgeMinAge {
+		r.logf("[info][%s] keeping source %q: modified less than %s ago", srv.Name, FileName(path), r.PurgeMinAge)
+		return
+	}
+	dsum, err := HashFile(target, packed)
+	if err != nil {
+		r.logf("[error][%s] keeping source %q: cannot verify destination %q: %v", srv.Name, FileName(path), target, err)
+		return
+	}
+	if !bytes.Equal(sum, dsum) {
+		r.logf("[error][%s] keeping source %q: checksum of destination %q does not match", srv.Name, FileName(path), target)
+		return
+	}
+	if err := srv.share.Remove(srv.rel(path)); err != nil {
+		r.logf("[error][%s] cannot remove source %q: %v", srv.Name, FileName(path), err)
+		return
+	}
+	r.logf("[info][%s] purged verified source %q", srv.Name, FileName(path))
+}
+
+// HashFile returns the SHA-256 of the content of the file at path, decompressing it first
+// when packed is set.
+func HashFile(path string, packed bool) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if packed {
+		zr, err := NewDecompressor(path, f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
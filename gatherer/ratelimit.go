@@ -0,0 +1,101 @@
+package gatherer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket of bytes, shared by the readers of all goroutines it limits.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64 // negative when readers are waiting for the bytes they already read
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter of rate bytes per second, or nil when rate is 0.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// ParseRate parses a rate such as 20MB/s, where the /s is optional, in bytes per second.
+func ParseRate(s string) (int64, error) {
+	size := strings.TrimSpace(s)
+	if len(size) >= 2 && strings.EqualFold(size[len(size)-2:], "/s") {
+		size = size[:len(size)-2]
+	}
+	n, err := ParseSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, expected a size per second such as 20MB/s", s)
+	}
+	return n, nil
+}
+
+// wait takes n bytes from the bucket and waits until the limiter has earned them or ctx is done.
+// At most a second worth of unused bytes is saved up, so that idle periods do not allow bursts.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateReader reads from r at most as fast as all of its limiters allow.
+type rateReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func (rr *rateReader) Read(p []byte) (int, error) {
+	// small reads keep the throughput smooth and the goroutines taking turns
+	if max := 32 << 10; len(p) > max {
+		p = p[:max]
+	}
+	n, err := rr.r.Read(p)
+	for _, l := range rr.limiters {
+		if werr := l.wait(rr.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// throttle returns source limited to -rate-limit and the server_rate_limit of srv, or source
+// itself when neither is set.
+func (r *run) throttle(ctx context.Context, srv *Server, source io.Reader) io.Reader {
+	var limiters []*rateLimiter
+	for _, l := range []*rateLimiter{r.rateLimit, srv.limit} {
+		if l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	if len(limiters) == 0 {
+		return source
+	}
+	return &rateReader{ctx: ctx, r: source, limiters: limiters}
+}
@@ -0,0 +1,96 @@
+package gatherer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// smbPermanent are the NTSTATUS codes of SMB errors which a retry does not fix: access denied,
+// file, path or share not found and the logon failures of bad or unusable credentials.
+var smbPermanent = map[uint32]bool{
+	0xC0000022: true, // STATUS_ACCESS_DENIED
+	0xC0000034: true, // STATUS_OBJECT_NAME_NOT_FOUND
+	0xC000003A: true, // STATUS_OBJECT_PATH_NOT_FOUND
+	0xC00000CC: true, // STATUS_BAD_NETWORK_NAME
+	0xC000006D: true, // STATUS_LOGON_FAILURE
+	0xC0000071: true, // STATUS_PASSWORD_EXPIRED
+	0xC0000072: true, // STATUS_ACCOUNT_DISABLED
+	0xC0000234: true, // STATUS_ACCOUNT_LOCKED_OUT
+}
+
+// isPermanent reports whether err is one which fails again on every attempt, such as a missing
+// file or a denied access. Any other error, such as a timeout, a reset connection or a file held
+// open by another process, may be over by the next attempt.
+func isPermanent(err error) bool {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	var rerr *smb2.ResponseError
+	return errors.As(err, &rerr) && smbPermanent[rerr.Code]
+}
+
+// transient reports whether err is worth retrying. RetryOn and NoRetryOn, matched against the
+// message of err, override the classification of isPermanent, with NoRetryOn taking precedence.
+func (r *run) transient(err error) bool {
+	for _, re := range r.NoRetryOn {
+		if re.MatchString(err.Error()) {
+			return false
+		}
+	}
+	for _, re := range r.RetryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return !isPermanent(err)
+}
+
+// ParseErrorPatterns parses the comma-separated regular expressions of list, such as
+// "i/o timeout, STATUS_NETWORK_NAME_DELETED", which are matched against error messages.
+func ParseErrorPatterns(list string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); len(p) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// retry calls fn until it succeeds or the configured number of retries is used up, doubling
+// the delay after every failed attempt. It returns the error of the last attempt. No further
+// attempts are made once ctx is done or the destination is full, or after an error which is
+// not transient.
+func (r *run) retry(ctx context.Context, srv *Server, what string, fn func() error) error {
+	delay := r.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > r.Retries || atomic.LoadInt32(&r.destFull) == 1 {
+			return err
+		}
+		if !r.transient(err) {
+			r.logf("[debug][%s] %s failed, not retrying a permanent error: %v", srv.Name, what, err)
+			return err
+		}
+		r.logf("[info][%s] %s failed, retrying in %s (retry %d of %d): %v", srv.Name, what, delay, attempt, r.Retries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,90 @@
+package gatherer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+func TestTransient(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	notFound := &fs.PathError{Op: "open", Path: "a.tmp", Err: fs.ErrNotExist}
+	tests := []struct {
+		name               string
+		err                error
+		retryOn, noRetryOn string
+		want               bool
+	}{
+		{"timeout", timeout, "", "", true},
+		{"connection reset", &fs.PathError{Op: "read", Path: "a.tmp", Err: syscall.ECONNRESET}, "", "", true},
+		{"smb transport", &smb2.TransportError{Err: errors.New("EOF")}, "", "", true},
+		{"smb sharing violation", &smb2.ResponseError{Code: 0xC0000043}, "", "", true},
+		{"not found", notFound, "", "", false},
+		{"permission", fmt.Errorf("cannot open: %w", fs.ErrPermission), "", "", false},
+		{"smb access denied", &fs.PathError{Op: "open", Path: "a.tmp", Err: &smb2.ResponseError{Code: 0xC0000022}}, "", "", false},
+		{"smb not found", &smb2.ResponseError{Code: 0xC0000034}, "", "", false},
+		{"bad credentials", fmt.Errorf("cannot log on to host as %q: %w", "svc", &smb2.ResponseError{Code: 0xC000006D}), "", "", false},
+		{"retry_on", notFound, `does not exist`, "", true},
+		{"retry_on not matching", notFound, `i/o timeout`, "", false},
+		{"no_retry_on", timeout, "", `I/O timeout, (?i)i/o timeout`, false},
+		{"no_retry_on before retry_on", notFound, `a\.tmp`, `open`, false},
+	}
+	for _, tt := range tests {
+		retryOn, err := ParseErrorPatterns(tt.retryOn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		noRetryOn, err := ParseErrorPatterns(tt.noRetryOn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &run{Config: Config{RetryOn: retryOn, NoRetryOn: noRetryOn}}
+		if got := r.transient(tt.err); got != tt.want {
+			t.Errorf("%s: transient(%v) = %t, want %t", tt.name, tt.err, got, tt.want)
+		}
+	}
+	if _, err := ParseErrorPatterns("timeout, (unclosed"); err == nil {
+		t.Errorf("ParseErrorPatterns accepted an invalid regular expression")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name     string
+		errs     []error // of the attempts, the last one is repeated
+		attempts int
+		err      error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"transient", []error{transient}, 4, transient},
+		{"transient, then success", []error{transient, nil}, 2, nil},
+		{"permanent", []error{fs.ErrNotExist}, 1, fs.ErrNotExist},
+		{"transient, then permanent", []error{transient, fs.ErrPermission}, 2, fs.ErrPermission},
+	}
+	for _, tt := range tests {
+		r, err := newRun(Config{Clusters: []*Cluster{{Name: "web", Shares: []string{"logs"}}}, Retries: 3, RetryDelay: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		attempts := 0
+		err = r.retry(context.Background(), &Server{Name: "web01"}, "reading", func() error {
+			attempts++
+			if attempts < len(tt.errs) {
+				return tt.errs[attempts-1]
+			}
+			return tt.errs[len(tt.errs)-1]
+		})
+		if attempts != tt.attempts || !errors.Is(err, tt.err) {
+			t.Errorf("%s: %d attempt(s) returning %v, want %d returning %v", tt.name, attempts, err, tt.attempts, tt.err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package gatherer
+
+import (
+	"container/heap"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// sourceFile is an entry of the log share, rel is its path relative to the share.
+type sourceFile struct {
+	fs.DirEntry
+	rel string
+}
+
+// sourceMatch is a file of the log share which passed the filters of its cluster.
+type sourceMatch struct {
+	file sourceFile
+	info os.FileInfo
+}
+
+// newestMatches returns the n most recently modified of matches, newest first, for -newest.
+func newestMatches(matches []sourceMatch, n int) []sourceMatch {
+	s := newestSet{n: n}
+	for _, m := range matches {
+		s.add(m)
+	}
+	return s.sorted()
+}
+
+// newestSet selects the n most recently modified of the matches added to it. It holds no more
+// than n of them, in a heap with the oldest on top, so selecting the newest files of a share with
+// millions of matches neither sorts nor keeps all of them.
+type newestSet struct {
+	n       int
+	added   int           // number of matches added so far
+	matches []sourceMatch // heap ordered by older
+}
+
+// older reports whether a was modified before b. Of the matches modified at the same time, the
+// one with the greatest path counts as older, so the selection does not depend on the order of
+// the listing.
+func older(a, b sourceMatch) bool {
+	ma, mb := a.info.ModTime(), b.info.ModTime()
+	if !ma.Equal(mb) {
+		return ma.Before(mb)
+	}
+	return a.file.rel > b.file.rel
+}
+
+func (s *newestSet) Len() int           { return len(s.matches) }
+func (s *newestSet) Less(i, j int) bool { return older(s.matches[i], s.matches[j]) }
+func (s *newestSet) Swap(i, j int)      { s.matches[i], s.matches[j] = s.matches[j], s.matches[i] }
+func (s *newestSet) Push(x interface{}) { s.matches = append(s.matches, x.(sourceMatch)) }
+func (s *newestSet) Pop() interface{} {
+	m := s.matches[len(s.matches)-1]
+	s.matches = s.matches[:len(s.matches)-1]
+	return m
+}
+
+// add adds m to the selection, replacing the oldest match selected so far once there are n.
+func (s *newestSet) add(m sourceMatch) {
+	s.added++
+	switch {
+	case len(s.matches) < s.n:
+		heap.Push(s, m)
+	case s.n > 0 && older(s.matches[0], m):
+		s.matches[0] = m
+		heap.Fix(s, 0)
+	}
+}
+
+// sorted returns the selected matches, newest first.
+func (s *newestSet) sorted() []sourceMatch {
+	sort.Slice(s.matches, func(i, j int) bool { return older(s.matches[j], s.matches[i]) })
+	return s.matches
+}
+
+// scanSource returns the files of the log share of srv, including those of all subfolders with
+// -recursive. Subfolders which cannot be read are logged, counted and skipped; only an error
+// reading the share itself is returned.
+//
+// Symbolic links, which includes junctions on Windows, are skipped unless -follow-symlinks is
+// set, in which case the entry describes the target instead. A folder is only scanned once, so
+// links back to a folder which was already scanned are skipped instead of scanned in a loop.
+func (r *run) scanSource(srv *Server) ([]sourceFile, error) {
+	w := &sourceWalk{run: r, srv: srv}
+	return w.scan()
+}
+
+// walkSource is scanSource without logging or counting the folders and links it skips.
+func (r *run) walkSource(srv *Server) ([]sourceFile, error) {
+	w := &sourceWalk{run: r, srv: srv, quiet: true}
+	return w.scan()
+}
+
+// sourceWalk is a single scan of the log share of srv.
+type sourceWalk struct {
+	run     *run
+	srv     *Server
+	quiet   bool
+	files   []sourceFile
+	visited map[string]bool // real paths of the folders scanned so far, with -follow-symlinks
+}
+
+// realPather is implemented by the shares which can resolve the links in a path. On the other
+// shares, links to folders are not followed.
+type realPather interface {
+	realPath(name string) (string, error)
+}
+
+func (w *sourceWalk) scan() ([]sourceFile, error) {
+	if w.run.FollowLinks {
+		w.visited = make(map[string]bool)
+		if !w.visit(".", false) {
+			return nil, fmt.Errorf("cannot resolve the path of the log share")
+		}
+	}
+	if err := w.dir("."); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// visit records that the folder name, which is the target of a link when linked is set, is
+// scanned. It returns false when it was scanned before or its real path cannot be determined.
+func (w *sourceWalk) visit(name string, linked bool) bool {
+	rp, ok := w.srv.share.(realPather)
+	if !ok {
+		// without links, no folder can be reached twice
+		return !linked
+	}
+	real, err := rp.realPath(name)
+	if err != nil || w.visited[real] {
+		return false
+	}
+	w.visited[real] = true
+	return true
+}
+
+// dir adds the files of the folder name, and with -recursive those of its subfolders.
+func (w *sourceWalk) dir(name string) error {
+	entries, err := w.srv.share.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		rel := e.Name()
+		if name != "." {
+			rel = fmt.Sprintf("%s/%s", name, e.Name())
+		}
+		linked := e.Type()&fs.ModeSymlink != 0
+		if linked {
+			if !w.run.FollowLinks {
+				w.logf("[info][%s] skipping symbolic link %q (-follow-symlinks is not set)", w.srv.Name, FileName(rel))
+				continue
+			}
+			target, err := w.srv.share.Stat(rel)
+			if err != nil {
+				w.errorf("[error][%s] cannot follow symbolic link %q: %v", w.srv.Name, FileName(rel), err)
+				continue
+			}
+			e = fs.FileInfoToDirEntry(target)
+		}
+		if !e.IsDir() {
+			w.files = append(w.files, sourceFile{DirEntry: e, rel: rel})
+			continue
+		}
+		if !w.run.Recursive {
+			continue
+		}
+		if w.run.FollowLinks && !w.visit(rel, linked) {
+			w.logf("[info][%s] skipping folder %q: it was scanned already or its path cannot be resolved", w.srv.Name, FileName(rel))
+			continue
+		}
+		if err := w.dir(rel); err != nil {
+			w.errorf("[error][%s] cannot read folder %q: %v", w.srv.Name, FileName(fmt.Sprintf("%s/%s", w.srv.src(), rel)), err)
+		}
+	}
+	return nil
+}
+
+func (w *sourceWalk) logf(format string, args ...interface{}) {
+	if !w.quiet {
+		w.run.logf(format, args...)
+	}
+}
+
+// errorf logs and counts an error of the server, unless the walk is quiet.
+func (w *sourceWalk) errorf(format string, args ...interface{}) {
+	if !w.quiet {
+		w.run.logf(format, args...)
+		w.run.countError(w.srv)
+	}
+}
@@ -0,0 +1,158 @@
+package gatherer
+
+import (
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// symlinkTree creates a log share with links to a file, to a folder outside the share, to a
+// folder which is scanned anyway and back to the share itself, and returns its path.
+func symlinkTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	share := filepath.Join(dir, "logs")
+	for _, name := range []string{"a.tmp", "sub/b.tmp", "../outside/c.tmp"} {
+		path := filepath.Join(share, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := []struct{ link, target string }{
+		{"link.tmp", "a.tmp"},
+		{"loop", "."},
+		{"out", filepath.Join("..", "outside")},
+		{"sublink", "sub"},
+		{filepath.Join("sub", "up"), ".."},
+	}
+	for _, l := range links {
+		if err := os.Symlink(l.target, filepath.Join(share, l.link)); err != nil {
+			t.Skipf("cannot create symbolic links: %v", err)
+		}
+	}
+	return share
+}
+
+// scanRun returns a run with the given -recursive and -follow-symlinks settings and a single
+// server, reading from the log share at share.
+func scanRun(t *testing.T, share string, recursive, follow bool) (*run, *Server) {
+	t.Helper()
+	srv := &Server{Name: "web01", share: osShare(share)}
+	cl := &Cluster{Name: "web", Destination: t.TempDir(), Shares: []string{"logs"}, Servers: []*Server{srv}}
+	r, err := newRun(Config{Clusters: []*Cluster{cl}, Recursive: recursive, FollowLinks: follow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, srv
+}
+
+func TestScanSourceSymlinks(t *testing.T) {
+	share := symlinkTree(t)
+	tests := []struct {
+		recursive, follow bool
+		want              []string
+	}{
+		{false, false, []string{"a.tmp"}},
+		{true, false, []string{"a.tmp", "sub/b.tmp"}},
+		{false, true, []string{"a.tmp", "link.tmp"}},
+		{true, true, []string{"a.tmp", "link.tmp", "out/c.tmp", "sub/b.tmp"}},
+	}
+	for _, tt := range tests {
+		r, srv := scanRun(t, share, tt.recursive, tt.follow)
+		files, err := r.scanSource(srv)
+		if err != nil {
+			t.Fatalf("scanSource(recursive %t, follow %t): %v", tt.recursive, tt.follow, err)
+		}
+		var got []string
+		for _, f := range files {
+			got = append(got, f.rel)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scanSource(recursive %t, follow %t) = %q, want %q", tt.recursive, tt.follow, got, tt.want)
+		}
+	}
+}
+
+func TestScanSourceFollowsTarget(t *testing.T) {
+	share := symlinkTree(t)
+	r, srv := scanRun(t, share, false, true)
+	files, err := r.scanSource(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		finfo, err := f.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the link is described by its target, a.tmp
+		if finfo.Mode()&os.ModeSymlink != 0 || finfo.Size() != int64(len("a.tmp")) {
+			t.Errorf("%s: mode %s, size %d, want the regular file a.tmp", f.rel, finfo.Mode(), finfo.Size())
+		}
+	}
+}
+
+// listedInfo is the file info of a synthetic listing entry.
+type listedInfo struct {
+	fs.FileInfo
+	mtime time.Time
+}
+
+func (fi listedInfo) ModTime() time.Time { return fi.mtime }
+
+func TestNewestSet(t *testing.T) {
+	// a listing far larger than the selection, with many files modified at the same time
+	const listed = 200000
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	matches := make([]sourceMatch, listed)
+	for i := range matches {
+		mtime := base.Add(time.Duration(rnd.Intn(listed/10)) * time.Second)
+		matches[i] = sourceMatch{sourceFile{rel: fmt.Sprintf("sub%d/%06d.log", i%7, i)}, listedInfo{mtime: mtime}}
+	}
+	want := append([]sourceMatch(nil), matches...)
+	sort.Slice(want, func(i, j int) bool {
+		mi, mj := want[i].info.ModTime(), want[j].info.ModTime()
+		if !mi.Equal(mj) {
+			return mi.After(mj)
+		}
+		return want[i].file.rel < want[j].file.rel
+	})
+
+	for _, n := range []int{1, 10, 1000, listed + 1} {
+		s := newestSet{n: n}
+		held := 0
+		for _, m := range matches {
+			s.add(m)
+			if len(s.matches) > held {
+				held = len(s.matches)
+			}
+		}
+		if held > n || s.added != listed {
+			t.Errorf("newest %d: held %d of %d match(es) added, want at most %d of %d", n, held, s.added, n, listed)
+		}
+		got := s.sorted()
+		expect := want
+		if n < listed {
+			expect = want[:n]
+		}
+		if len(got) != len(expect) {
+			t.Fatalf("newest %d: selected %d match(es), want %d", n, len(got), len(expect))
+		}
+		for i := range got {
+			if got[i].file.rel != expect[i].file.rel {
+				t.Errorf("newest %d: match %d is %s, want %s", n, i, got[i].file.rel, expect[i].file.rel)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package gatherer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// share is the log share of a server. Names are slash-separated paths relative to the share,
+// "." being the share itself.
+type share interface {
+	fs.StatFS
+	fs.ReadDirFS
+	Remove(name string) error
+	// Owner returns the owner of the file name described by finfo, see fileOwner.
+	Owner(name string, finfo fs.FileInfo) (string, error)
+	Close() error
+}
+
+// openShare connects to the log share of srv. Without a username configured for its cluster the
+// share is reached through the file system of this machine, that is with the credentials of the
+// current session, otherwise an SMB session is set up with the configured credentials.
+func openShare(ctx context.Context, srv *Server) (share, error) {
+	cl := srv.Cluster
+	if len(cl.Username) == 0 {
+		return osShare(srv.src()), nil
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(srv.Host, "445"))
+	if err != nil {
+		return nil, err
+	}
+	dialer := &smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: cl.Username, Password: cl.Password, Domain: cl.Domain}}
+	session, err := dialer.DialContext(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot log on to %s as %q: %w", srv.Host, cl.Username, err)
+	}
+	// the log share may be a folder below the share name
+	name, root, _ := strings.Cut(ShareFolder(srv.logshare), "/")
+	mount, err := session.WithContext(ctx).Mount(fmt.Sprintf(`\\%s\%s`, srv.Host, name))
+	if err != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, err
+	}
+	return &smbShare{conn: conn, session: session, share: mount.WithContext(ctx), root: root}, nil
+}
+
+// osShare is a log share reached through the file system of this machine.
+type osShare string
+
+func (s osShare) path(name string) string {
+	if name == "." {
+		return string(s)
+	}
+	return fmt.Sprintf("%s/%s", s, name)
+}
+
+func (s osShare) Open(name string) (fs.File, error) {
+	return os.Open(s.path(name))
+}
+
+func (s osShare) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(s.path(name))
+}
+
+func (s osShare) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(s.path(name))
+}
+
+func (s osShare) Remove(name string) error {
+	return os.Remove(s.path(name))
+}
+
+func (s osShare) Owner(name string, finfo fs.FileInfo) (string, error) {
+	return fileOwner(s.path(name), finfo)
+}
+
+func (s osShare) realPath(name string) (string, error) {
+	return filepath.EvalSymlinks(s.path(name))
+}
+
+func (s osShare) Close() error {
+	return nil
+}
+
+// smbShare is a log share reached over an SMB session of its own.
+type smbShare struct {
+	conn    net.Conn
+	session *smb2.Session
+	share   *smb2.Share
+	root    string // folder of the log share below the share name
+}
+
+func (s *smbShare) path(name string) string {
+	switch {
+	case name == ".":
+		return s.root
+	case len(s.root) == 0:
+		return name
+	}
+	return fmt.Sprintf("%s/%s", s.root, name)
+}
+
+func (s *smbShare) Open(name string) (fs.File, error) {
+	f, err := s.share.Open(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return smbFile{f}, nil
+}
+
+func (s *smbShare) Stat(name string) (fs.FileInfo, error) {
+	finfo, err := s.share.Stat(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return smbFileInfo{finfo.(*smb2.FileStat)}, nil
+}
+
+func (s *smbShare) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.share.ReadDir(s.path(name))
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, finfo := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(smbFileInfo{finfo.(*smb2.FileStat)}))
+	}
+	return entries, err
+}
+
+func (s *smbShare) Remove(name string) error {
+	return s.share.Remove(s.path(name))
+}
+
+func (s *smbShare) Owner(string, fs.FileInfo) (string, error) {
+	return "", errors.New("no ownership information available over an SMB session")
+}
+
+func (s *smbShare) Close() error {
+	s.share.Umount()
+	s.session.Logoff()
+	return s.conn.Close()
+}
+
+// smbFile is a file on an smbShare.
+type smbFile struct {
+	*smb2.File
+}
+
+func (f smbFile) Stat() (fs.FileInfo, error) {
+	finfo, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return smbFileInfo{finfo.(*smb2.FileStat)}, nil
+}
+
+// smbFileInfo describes a file on an smbShare. Its Sys value reports the creation time to
+// gatherer.CreateTime.
+type smbFileInfo struct {
+	*smb2.FileStat
+}
+
+func (fi smbFileInfo) Sys() interface{} {
+	return fi
+}
+
+func (fi smbFileInfo) CreateTime() time.Time {
+	return fi.CreationTime
+}
@@ -0,0 +1,81 @@
+package gatherer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// skipUnchanged reports, for -skip-mode hash, whether the source file at path of srv was
+// copied into the window folder before and its content did not change since, according to the
+// digest in the manifest an earlier run left there. Its entry is then recorded again, so the
+// manifest of this run still holds it. Sources whose copy may be incomplete are always copied.
+func (r *run) skipUnchanged(ctx context.Context, srv *Server, path string, finfo os.FileInfo) bool {
+	prev, ok := r.previousEntry(srv, path)
+	if !ok || len(prev.SHA256) == 0 || prev.Unstable {
+		return false
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s/%s", srv.Cluster.Destination, prev.Copy)); err != nil {
+		return false
+	}
+	sum, err := r.sourceDigest(ctx, srv, path)
+	if err != nil {
+		r.logf("[warning][%s] cannot hash %q to compare it to its copy, copying it again: %v", srv.Name, FileName(finfo.Name()), err)
+		return false
+	}
+	if hex.EncodeToString(sum) != prev.SHA256 {
+		return false
+	}
+	r.logf("[info][%s] skipping %q: its content did not change since it was copied to %q", srv.Name, FileName(finfo.Name()), FileName(prev.Copy))
+	r.addManifest(srv, finfo, prev)
+	return true
+}
+
+// previousEntry returns the entry of the source file at path of srv in the manifest of the
+// window folder of its cluster, which is read once per run, before this run replaces it.
+func (r *run) previousEntry(srv *Server, path string) (ManifestEntry, bool) {
+	r.previousMu.Lock()
+	defer r.previousMu.Unlock()
+	entries, ok := r.previous[srv.Cluster.Name]
+	if !ok {
+		entries = make(map[string]ManifestEntry)
+		list, err := ReadManifest(srv.Cluster.Destination)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.logf("[warning] cannot read the manifest of %q, copying all files of cluster %q: %v", FileName(srv.Cluster.Destination), srv.Cluster.Name, err)
+		}
+		for _, e := range list {
+			entries[e.Server+"\x00"+e.Path] = e
+		}
+		r.previous[srv.Cluster.Name] = entries
+	}
+	e, ok := entries[srv.Name+"\x00"+path]
+	return e, ok
+}
+
+// sourceDigest returns the SHA-256 of the content of the source file at path of srv. A source
+// is only read for it once per run, a retried copy uses the digest read before.
+func (r *run) sourceDigest(ctx context.Context, srv *Server, path string) ([]byte, error) {
+	r.digestMu.Lock()
+	sum, ok := r.digests[path]
+	r.digestMu.Unlock()
+	if ok {
+		return sum, nil
+	}
+	f, err := srv.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if err := copyFile(ctx, r.throttle(ctx, srv, f), h); err != nil {
+		return nil, err
+	}
+	sum = h.Sum(nil)
+	r.digestMu.Lock()
+	r.digests[path] = sum
+	r.digestMu.Unlock()
+	return sum, nil
+}
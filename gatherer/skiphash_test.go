@@ -0,0 +1,74 @@
+package gatherer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSkipUnchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, share, window string) // between the two gathers
+		skip   bool
+	}{
+		{"unchanged", func(*testing.T, string, string) {}, true},
+		{"content changed", func(t *testing.T, share, _ string) {
+			// the size and modification time stay the same, which -skip-mode mtime would skip
+			path := filepath.Join(share, "a.tmp")
+			finfo, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("b.tmp"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, finfo.ModTime(), finfo.ModTime()); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"copy removed", func(t *testing.T, _, window string) {
+			if err := os.Remove(filepath.Join(window, "web01", "a.tmp")); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"manifest removed", func(t *testing.T, _, window string) {
+			if err := os.Remove(filepath.Join(window, "manifest.csv")); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testCluster(t, map[string]time.Duration{"a.tmp": 30 * time.Minute}, nil)
+			cfg := Config{Clusters: []*Cluster{cl}, Manifest: "csv", SkipExisting: true, SkipMode: "hash"}
+			if _, err := Gather(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			share := filepath.FromSlash("/" + cl.Servers[0].Host + "/" + cl.Shares[0])
+			tt.change(t, share, filepath.FromSlash(cl.Destination))
+
+			stats, err := Gather(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ServerStats{Matched: 1, Copied: 1}
+			if tt.skip {
+				want = ServerStats{Matched: 1, Skipped: 1}
+			}
+			if tot := stats.Totals(); tot.Matched != want.Matched || tot.Copied != want.Copied || tot.Skipped != want.Skipped {
+				t.Errorf("matched %d, copied %d and skipped %d file(s), want %d, %d and %d", tot.Matched, tot.Copied, tot.Skipped, want.Matched, want.Copied, want.Skipped)
+			}
+			// a skipped file stays in the manifest, so the next run can skip it again
+			entries, err := ReadManifest(cl.Destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Copy != "web01/a.tmp" || len(entries[0].SHA256) == 0 {
+				t.Errorf("manifest holds %+v, want the copy web01/a.tmp with its digest", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package gatherer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// startLayout is the layout of an absolute start time.
+const startLayout = "2006-01-02 15:04:05"
+
+// ParseStart parses the start s of a period, relative to now where needed, in loc. It accepts
+//
+//   - an absolute time, such as 2023-02-01 10:00:00
+//   - a duration relative to now with a leading - or +, such as -2h or +30m
+//   - now, today or yesterday, where today and yesterday are at midnight unless followed by a
+//     time of day, such as today 09:00 or yesterday 13:30:00
+func ParseStart(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	return parseTime("start", s, now, loc)
+}
+
+// ParseEnd parses the end s of a period like ParseStart.
+func ParseEnd(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	return parseTime("end", s, now, loc)
+}
+
+// parseTime parses s for ParseStart and ParseEnd, what is the name of s in the errors.
+func parseTime(what, s string, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse %s %q as a relative time: %v", what, s, err)
+		}
+		return now.Add(d), nil
+	}
+
+	word, clock, _ := strings.Cut(s, " ")
+	var day time.Time
+	switch n := now.In(loc); strings.ToLower(word) {
+	case "now":
+		if len(clock) > 0 {
+			return time.Time{}, fmt.Errorf("cannot parse %s %q: now takes no time of day", what, s)
+		}
+		return now, nil
+	case "today":
+		day = time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, loc)
+	case "yesterday":
+		day = time.Date(n.Year(), n.Month(), n.Day()-1, 0, 0, 0, 0, loc)
+	default:
+		t, err := time.ParseInLocation(startLayout, s, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse %s %q, expected yyyy-MM-dd HH:mm:ss, a relative time such as -2h, or now, today or yesterday with an optional HH:mm[:ss]", what, s)
+		}
+		return t, nil
+	}
+	if clock = strings.TrimSpace(clock); len(clock) == 0 {
+		return day, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, clock); err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %s %q: invalid time of day %q, expected HH:mm or HH:mm:ss", what, s, clock)
+}
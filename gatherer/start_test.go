@@ -0,0 +1,55 @@
+package gatherer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStart(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2023, 2, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"2023-01-31 08:00:00", time.UTC, time.Date(2023, 1, 31, 8, 0, 0, 0, time.UTC)},
+		{"2023-01-31 08:00:00", ams, time.Date(2023, 1, 31, 7, 0, 0, 0, time.UTC)},
+		{"-2h", time.UTC, now.Add(-2 * time.Hour)},
+		{"+30m", time.UTC, now.Add(30 * time.Minute)},
+		{"-1h30m", ams, now.Add(-90 * time.Minute)},
+		{"now", time.UTC, now},
+		{"today", time.UTC, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Today 09:00", time.UTC, time.Date(2023, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"today 09:00", ams, time.Date(2023, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"yesterday", time.UTC, time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"yesterday 13:30:15", time.UTC, time.Date(2023, 1, 31, 13, 30, 15, 0, time.UTC)},
+		{" yesterday  ", time.UTC, time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseStart(tt.in, now, tt.loc)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseStart(%q, %s) = %s, %v, want %s", tt.in, tt.loc, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "-2", "-2x", "tomorrow", "today 25:00", "today 9", "now 09:00", "2023-01-31", "2023-01-31T08:00:00Z"} {
+		if _, err := ParseStart(in, now, time.UTC); err == nil {
+			t.Errorf("ParseStart(%q) accepted the start", in)
+		}
+	}
+}
+
+func TestParseEnd(t *testing.T) {
+	now := time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)
+	if got, err := ParseEnd("2023-02-01 12:30:00", now, time.UTC); err != nil || !got.Equal(now.Add(150*time.Minute)) {
+		t.Errorf("ParseEnd = %s, %v, want %s", got, err, now.Add(150*time.Minute))
+	}
+	if _, err := ParseEnd("tomorrow", now, time.UTC); err == nil || !strings.Contains(err.Error(), "cannot parse end") {
+		t.Errorf("ParseEnd(tomorrow) = %v, want an error about the end", err)
+	}
+}
@@ -0,0 +1,145 @@
+package gatherer
+
+import (
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// ServerStats are the statistics of gathering from a single server, or the totals of several.
+type ServerStats struct {
+	Cluster    string
+	Server     string
+	Matched    int   // files matching the filters
+	Copied     int   // files copied successfully
+	Skipped    int   // files skipped by SkipExisting, NoClobber or OnExists skip
+	Changed    int   // files which changed while they were copied
+	Compressed int   // files compressed by the format, the other copies are as-is
+	Read       int64 // bytes read from the source
+	Written    int64 // bytes written to the destination
+	Errors     int
+}
+
+// Stats are the statistics of a gather.
+type Stats struct {
+	Servers         []ServerStats // sorted by cluster and server
+	TimedOut        []string      // cluster/server of the servers which did not finish in time
+	DestinationFull bool          // the destination ran out of space, which stopped the gather
+	Failed          bool          // FailFast stopped the gather at the first error
+}
+
+// Totals returns the statistics of all servers of s added up.
+func (s Stats) Totals() ServerStats {
+	var t ServerStats
+	for i := range s.Servers {
+		t.Add(&s.Servers[i])
+	}
+	return t
+}
+
+// Add adds the counts of o to s.
+func (s *ServerStats) Add(o *ServerStats) {
+	s.Matched += o.Matched
+	s.Copied += o.Copied
+	s.Skipped += o.Skipped
+	s.Changed += o.Changed
+	s.Compressed += o.Compressed
+	s.Read += o.Read
+	s.Written += o.Written
+	s.Errors += o.Errors
+}
+
+// statsKey identifies a server across all clusters of a run.
+type statsKey struct {
+	cluster, server string
+}
+
+// record applies fn to the statistics of srv.
+func (r *run) record(srv *Server, fn func(s *ServerStats)) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	key := statsKey{srv.Cluster.Name, srv.Name}
+	s, ok := r.stats[key]
+	if !ok {
+		s = &ServerStats{Cluster: key.cluster, Server: key.server}
+		r.stats[key] = s
+	}
+	fn(s)
+}
+
+func (r *run) countMatched(srv *Server) {
+	r.record(srv, func(s *ServerStats) { s.Matched++ })
+}
+
+func (r *run) countError(srv *Server) {
+	r.record(srv, func(s *ServerStats) { s.Errors++ })
+	if r.FailFast {
+		r.failRun(srv)
+	}
+}
+
+func (r *run) countSkipped(srv *Server) {
+	r.record(srv, func(s *ServerStats) { s.Skipped++ })
+}
+
+func (r *run) countChanged(srv *Server) {
+	r.record(srv, func(s *ServerStats) { s.Changed++ })
+}
+
+func (r *run) countCompressed(srv *Server) {
+	r.record(srv, func(s *ServerStats) { s.Compressed++ })
+}
+
+func (r *run) countCopied(srv *Server, read, written int64) {
+	r.record(srv, func(s *ServerStats) {
+		s.Copied++
+		s.Read += read
+		s.Written += written
+	})
+}
+
+// statistics returns the statistics of the run so far.
+func (r *run) statistics() Stats {
+	var s Stats
+	r.statsMu.Lock()
+	for _, st := range r.stats {
+		s.Servers = append(s.Servers, *st)
+	}
+	r.statsMu.Unlock()
+	sort.Slice(s.Servers, func(i, j int) bool {
+		if s.Servers[i].Cluster != s.Servers[j].Cluster {
+			return s.Servers[i].Cluster < s.Servers[j].Cluster
+		}
+		return s.Servers[i].Server < s.Servers[j].Server
+	})
+	r.timedOutMu.Lock()
+	s.TimedOut = append(s.TimedOut, r.timedOut...)
+	r.timedOutMu.Unlock()
+	s.DestinationFull = atomic.LoadInt32(&r.destFull) == 1
+	s.Failed = atomic.LoadInt32(&r.failed) == 1
+	return s
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
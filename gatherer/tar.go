@@ -0,0 +1,120 @@
+package gatherer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// tarArchive writes all gathered files of a single server to one gzipped tar archive for
+// -format tar.gz. The archive is only created once the first file is added.
+type tarArchive struct {
+	run  *run
+	srv  *Server
+	path string
+	f    *os.File
+	cw   *countingWriter
+	zw   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func (r *run) newTarArchive(srv *Server, path string) *tarArchive {
+	return &tarArchive{run: r, srv: srv, path: path}
+}
+
+// add adds the source file at path to the archive as name, with the size finfo gives and the
+// modification time the copy would get. Opening the source is retried.
+func (a *tarArchive) add(ctx context.Context, path, name string, finfo os.FileInfo) {
+	var s fs.File
+	err := a.run.retry(ctx, a.srv, fmt.Sprintf("opening %q", name), func() (err error) {
+		s, err = a.srv.open(path)
+		return err
+	})
+	if err != nil {
+		a.run.logf("[error][%s] cannot open source file %q: %v", a.srv.Name, FileName(name), err)
+		a.run.countError(a.srv)
+		return
+	}
+	defer s.Close()
+
+	if a.tw == nil {
+		if a.f, err = CreateFile(a.path, a.run.FileMode); err != nil {
+			a.run.logf("[error][%s] cannot create archive %q: %v", a.srv.Name, FileName(a.path), err)
+			a.run.countError(a.srv)
+			if IsDiskFull(err) {
+				a.run.markDestinationFull(a.srv.Name, err)
+			}
+			return
+		}
+		a.cw = &countingWriter{w: a.f}
+		a.zw, _ = gzip.NewWriterLevel(a.cw, a.run.CompressLevel)
+		a.tw = tar.NewWriter(a.zw)
+	}
+
+	in := &countingReader{r: a.run.throttle(ctx, a.srv, s)}
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: finfo.Size(), Mode: 0644, ModTime: a.run.targetModTime(a.srv, finfo)}
+	h := sha256.New()
+	err = a.tw.WriteHeader(hdr)
+	if err == nil {
+		// the size of an entry is fixed by its header, so a source which grows is cut off and
+		// one which shrinks is padded, which sourceChanged reports
+		w := a.run.withProgress(io.MultiWriter(a.tw, h), a.srv, name, hdr.Size)
+		err = copyFile(ctx, io.LimitReader(in, hdr.Size), w)
+		if err == nil && in.n < hdr.Size {
+			_, err = io.CopyN(w, zeros{}, hdr.Size-in.n)
+		}
+	}
+	if err != nil {
+		a.run.logf("[error][%s] cannot add %q to archive %q: %v", a.srv.Name, FileName(name), a.path, err)
+		a.run.countError(a.srv)
+		if IsDiskFull(err) {
+			a.run.markDestinationFull(a.srv.Name, err)
+		}
+		return
+	}
+	a.run.countCopied(a.srv, in.n, 0)
+	a.run.addManifest(a.srv, finfo, ManifestEntry{
+		Path:     path,
+		Copy:     fmt.Sprintf("%s.tar.gz:%s", a.srv.Folder, name),
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+		Unstable: a.run.sourceChanged(a.srv, path, finfo, in.n),
+	})
+}
+
+// close finishes and closes the archive, if it was created.
+func (a *tarArchive) close() {
+	if a.tw == nil {
+		return
+	}
+	err := a.tw.Close()
+	if err == nil {
+		err = a.zw.Close()
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		a.run.logf("[error][%s] cannot write archive %q: %v", a.srv.Name, FileName(a.path), err)
+		a.run.countError(a.srv)
+		if IsDiskFull(err) {
+			a.run.markDestinationFull(a.srv.Name, err)
+		}
+	}
+	a.run.record(a.srv, func(s *ServerStats) { s.Written += a.cw.n })
+}
+
+// zeros reads an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
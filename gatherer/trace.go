@@ -0,0 +1,110 @@
+package gatherer
+
+import (
+	"io"
+	"time"
+)
+
+// ioStat keeps the number of calls to and the time spent in a read or write operation.
+type ioStat struct {
+	calls int
+	d     time.Duration
+}
+
+type tracedReader struct {
+	r io.Reader
+	s *ioStat
+}
+
+func (t tracedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	t.s.d += time.Since(start)
+	t.s.calls++
+	return n, err
+}
+
+type tracedWriter struct {
+	w io.Writer
+	s *ioStat
+}
+
+func (t tracedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	t.s.d += time.Since(start)
+	t.s.calls++
+	return n, err
+}
+
+// fileTrace collects the duration of the I/O phases of a single file copy when -trace-io is set.
+// All methods are no-ops on a nil *fileTrace, which is what newFileTrace returns when tracing
+// is disabled.
+type fileTrace struct {
+	run                  *run
+	mark                 time.Time
+	open, close, chtimes time.Duration
+	read, write          ioStat
+}
+
+func (r *run) newFileTrace() *fileTrace {
+	if !r.TraceIO {
+		return nil
+	}
+	return &fileTrace{run: r, mark: time.Now()}
+}
+
+// lap adds the time passed since the previous lap to d.
+func (t *fileTrace) lap(d *time.Duration) {
+	now := time.Now()
+	if d != nil {
+		*d += now.Sub(t.mark)
+	}
+	t.mark = now
+}
+
+func (t *fileTrace) opened() {
+	if t != nil {
+		t.lap(&t.open)
+	}
+}
+
+func (t *fileTrace) copied() {
+	if t != nil {
+		t.lap(nil)
+	}
+}
+
+func (t *fileTrace) closed() {
+	if t != nil {
+		t.lap(&t.close)
+	}
+}
+
+func (t *fileTrace) timesSet() {
+	if t != nil {
+		t.lap(&t.chtimes)
+	}
+}
+
+func (t *fileTrace) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return tracedReader{r: r, s: &t.read}
+}
+
+func (t *fileTrace) writer(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	return tracedWriter{w: w, s: &t.write}
+}
+
+func (t *fileTrace) print(server, name string) {
+	if t == nil {
+		return
+	}
+	t.run.logf("[debug][%s] io trace %s: open=%s read=%s (%d calls) write=%s (%d calls) close=%s chtimes=%s",
+		server, name, t.open, t.read.d, t.read.calls, t.write.d, t.write.calls, t.close, t.chtimes)
+}
@@ -0,0 +1,134 @@
+package gatherer
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// archive writes all gathered files of a single server to one archive, for -format zip and
+// tar.gz. Each server has an archive of its own, which only its own goroutine adds files to.
+type archive interface {
+	// add adds the source file at path to the archive as name
+	add(ctx context.Context, path, name string, finfo os.FileInfo)
+	// close finishes and closes the archive
+	close()
+}
+
+// newArchive returns the -format archive of srv, next to its destination folder dst.
+func (r *run) newArchive(srv *Server, dst string) archive {
+	if r.Format == "tar.gz" {
+		return r.newTarArchive(srv, fmt.Sprintf("%s.tar.gz", dst))
+	}
+	return r.newZipArchive(srv, fmt.Sprintf("%s.zip", dst))
+}
+
+// zipArchive writes all gathered files of a single server to one zip archive for -format zip.
+// The archive is only created once the first file is added.
+type zipArchive struct {
+	run  *run
+	srv  *Server
+	path string
+	f    *os.File
+	cw   *countingWriter
+	zw   *zip.Writer
+}
+
+func (r *run) newZipArchive(srv *Server, path string) *zipArchive {
+	return &zipArchive{run: r, srv: srv, path: path}
+}
+
+// add adds the source file at path to the archive as name, with the modification time the copy
+// would get. Opening the source is retried.
+func (a *zipArchive) add(ctx context.Context, path, name string, finfo os.FileInfo) {
+	var s fs.File
+	err := a.run.retry(ctx, a.srv, fmt.Sprintf("opening %q", name), func() (err error) {
+		s, err = a.srv.open(path)
+		return err
+	})
+	if err != nil {
+		a.run.logf("[error][%s] cannot open source file %q: %v", a.srv.Name, FileName(name), err)
+		a.run.countError(a.srv)
+		return
+	}
+	defer s.Close()
+
+	if a.zw == nil {
+		if a.f, err = CreateFile(a.path, a.run.FileMode); err != nil {
+			a.run.logf("[error][%s] cannot create archive %q: %v", a.srv.Name, FileName(a.path), err)
+			a.run.countError(a.srv)
+			if IsDiskFull(err) {
+				a.run.markDestinationFull(a.srv.Name, err)
+			}
+			return
+		}
+		a.cw = &countingWriter{w: a.f}
+		a.zw = zip.NewWriter(a.cw)
+		a.zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, a.run.CompressLevel)
+		})
+	}
+
+	in := &countingReader{r: a.run.throttle(ctx, a.srv, s)}
+	r, pack, err := a.run.packSource(a.srv, bufio.NewReader(in), finfo.Name(), finfo.Size(), false)
+	if err != nil {
+		a.run.logf("[error][%s] %v", a.srv.Name, err)
+		a.run.countError(a.srv)
+		return
+	}
+	hdr := &zip.FileHeader{Name: name, Modified: a.run.targetModTime(a.srv, finfo), Method: zip.Store}
+	if pack {
+		hdr.Method = zip.Deflate
+	}
+	h := sha256.New()
+	w, err := a.zw.CreateHeader(hdr)
+	if err == nil {
+		err = copyFile(ctx, io.TeeReader(r, h), a.run.withProgress(w, a.srv, name, finfo.Size()))
+	}
+	if err != nil {
+		a.run.logf("[error][%s] cannot add %q to archive %q: %v", a.srv.Name, FileName(name), a.path, err)
+		a.run.countError(a.srv)
+		if IsDiskFull(err) {
+			a.run.markDestinationFull(a.srv.Name, err)
+		}
+		return
+	}
+	a.run.countCopied(a.srv, in.n, 0)
+	if pack {
+		a.run.countCompressed(a.srv)
+	}
+	a.run.addManifest(a.srv, finfo, ManifestEntry{
+		Path:       path,
+		Copy:       fmt.Sprintf("%s.zip:%s", a.srv.Folder, name),
+		Compressed: pack,
+		SHA256:     hex.EncodeToString(h.Sum(nil)),
+		Unstable:   a.run.sourceChanged(a.srv, path, finfo, in.n),
+	})
+}
+
+// close finishes and closes the archive, if it was created. Deflate writes the last block of
+// the last file and the file system may only report a full volume here, so both are checked.
+func (a *zipArchive) close() {
+	if a.zw == nil {
+		return
+	}
+	err := a.zw.Close()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		a.run.logf("[error][%s] cannot write archive %q: %v", a.srv.Name, FileName(a.path), err)
+		a.run.countError(a.srv)
+		if IsDiskFull(err) {
+			a.run.markDestinationFull(a.srv.Name, err)
+		}
+	}
+	a.run.record(a.srv, func(s *ServerStats) { s.Written += a.cw.n })
+}
@@ -3,8 +3,16 @@ module ipsos.com/utils/loggatherer
 go 1.18
 
 require (
+	github.com/hirochachacha/go-smb2 v1.1.0
+	github.com/klauspost/compress v1.15.15
 	github.com/mvanwaaijen/execpath v0.0.0-20210217120723-2e4f4f53ebef
+	golang.org/x/sys v0.5.0
 	gopkg.in/ini.v1 v1.66.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/stretchr/testify v1.7.1 // indirect
+require (
+	github.com/geoffgarside/ber v1.1.0 // indirect
+	github.com/stretchr/testify v1.7.1 // indirect
+	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de // indirect
+)